@@ -0,0 +1,449 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+	"storj.io/uplink"
+)
+
+// CatalogPrefix is the prefix, under the upload path, of the catalog of backed up sources.
+// It starts with a dot so that it is never taken for the prefix of a backup.
+const CatalogPrefix = ".catalog/"
+
+// catalogSaltContext is hashed with the bucket into the salt of the catalog key,
+// which has to be derived again from the key alone to find the catalog.
+const catalogSaltContext = "driver-ipfs/catalog\n"
+
+// Catalog is the record, kept in the bucket, of the snapshots taken of every source.
+// Each source has its own object, named after an HMAC of the source and sealed
+// under a key derived from the user's key, so that neither reveals the source.
+type Catalog struct {
+	project    *uplink.Project
+	bucket     string
+	uploadPath string
+	nameKey    []byte
+	sealKey    []byte
+}
+
+// SourceHistory lists the snapshots of one source, oldest first.
+type SourceHistory struct {
+	Version   int        `json:"version"`
+	Source    string     `json:"source"`
+	Snapshots []Snapshot `json:"snapshots"`
+}
+
+// Snapshot is one backup of a source. It holds the data key of the backup,
+// so that it can be restored and reused without opening its envelope.
+type Snapshot struct {
+	BaseCID    string             `json:"baseCID"`
+	Name       string             `json:"name,omitempty"`
+	ID         string             `json:"id,omitempty"`
+	Hash       string             `json:"hash"`
+	UploadPath string             `json:"uploadPath"`
+	FileName   string             `json:"fileName"`
+	Size       int64              `json:"size"`
+	Chunks     int                `json:"chunks"`
+	Reused     int                `json:"reused"`
+	Created    time.Time          `json:"created"`
+	DataKey    []byte             `json:"dataKey"`
+	Signature  *ManifestSignature `json:"signature,omitempty"`
+}
+
+// OpenCatalog derives the catalog keys of the configured bucket from key.
+func OpenCatalog(project *uplink.Project, configStorj ConfigStorj, key string) (*Catalog, error) {
+	if key == "" {
+		return nil, errors.New("the catalog of sources needs the key")
+	}
+	root, err := bucketRootKey(key, configStorj.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &Catalog{
+		project:    project,
+		bucket:     configStorj.Bucket,
+		uploadPath: configStorj.UploadPath,
+		nameKey:    catalogSubkey(root, "name"),
+		sealKey:    catalogSubkey(root, "seal"),
+	}, nil
+}
+
+// bucketRootKey derives from key the root of the keys of the catalog and object names in bucket.
+func bucketRootKey(key string, bucket string) ([]byte, error) {
+	salt := sha256.Sum256([]byte(catalogSaltContext + bucket))
+	return scrypt.Key([]byte(key), salt[:kekSaltSize], kekScryptN, kekScryptR, kekScryptP, DataKeySize)
+}
+
+func catalogSubkey(root []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, root)
+	_, _ = mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// objectName returns the name of the catalog object of source, relative to the upload path.
+func (catalog *Catalog) objectName(source string) string {
+	mac := hmac.New(sha256.New, catalog.nameKey)
+	_, _ = mac.Write([]byte(source))
+	return CatalogPrefix + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Load returns the history of source, which is empty when it was never backed up.
+func (catalog *Catalog) Load(source string) (SourceHistory, error) {
+
+	history, err := catalog.loadObject(catalog.uploadPath + catalog.objectName(source))
+	if errors.Is(err, uplink.ErrObjectNotFound) {
+		return SourceHistory{Version: EnvelopeVersion, Source: source}, nil
+	}
+	if err != nil {
+		return history, err
+	}
+	if history.Source != source {
+		return history, fmt.Errorf("catalog object of %q belongs to another source", source)
+	}
+	return history, nil
+}
+
+// loadObject reads and decrypts the catalog object at key.
+func (catalog *Catalog) loadObject(key string) (SourceHistory, error) {
+
+	var history SourceHistory
+
+	download, err := catalog.project.DownloadObject(context.Background(), catalog.bucket, key, nil)
+	if errors.Is(err, uplink.ErrObjectNotFound) {
+		return history, err
+	}
+	if err != nil {
+		return history, fmt.Errorf("could not open catalog: %v", err)
+	}
+	sealed, err := ioutil.ReadAll(download)
+	if closeErr := download.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return history, fmt.Errorf("could not read catalog: %v", err)
+	}
+
+	if err = openJSON(catalog.sealKey, sealed, &history); err != nil {
+		return history, fmt.Errorf("could not decrypt catalog object %s, was it written with another key? %v", key, err)
+	}
+	return history, nil
+}
+
+// Save replaces the stored history of its source.
+func (catalog *Catalog) Save(history SourceHistory) {
+	sealed, err := sealJSON(catalog.sealKey, history)
+	if err != nil {
+		log.Fatal("Could not encrypt catalog: ", err)
+	}
+	uploadObject(catalog.project, ConfigStorj{Bucket: catalog.bucket, UploadPath: catalog.uploadPath},
+		catalog.objectName(history.Source), bytes.NewReader(sealed))
+}
+
+// RekeyCatalog moves the catalog of every source, and the pinsets, from oldKey to newKey.
+// The hashes of snapshots are replaced by newHashes, by their old hash, for the backups that were rekeyed.
+// It returns the number of sources moved.
+func RekeyCatalog(project *uplink.Project, configStorj ConfigStorj, oldKey string, newKey string, newHashes map[string]string) (int, error) {
+
+	oldCatalog, err := OpenCatalog(project, configStorj, oldKey)
+	if err != nil {
+		return 0, err
+	}
+	newCatalog, err := OpenCatalog(project, configStorj, newKey)
+	if err != nil {
+		return 0, err
+	}
+
+	keys, err := oldCatalog.objectKeys()
+	if err != nil {
+		return 0, err
+	}
+
+	for moved, key := range keys {
+		history, err := oldCatalog.loadObject(key)
+		if err != nil {
+			return moved, err
+		}
+		replaceHashes(history.Snapshots, newHashes)
+		newCatalog.Save(history)
+		if _, err = project.DeleteObject(context.Background(), configStorj.Bucket, key); err != nil {
+			return moved, fmt.Errorf("could not delete old catalog object %s: %v", key, err)
+		}
+	}
+
+	// Pinsets keep their ids, saving them under the new key replaces them.
+	ids, err := oldCatalog.PinSetIDs()
+	if err != nil {
+		return len(keys), err
+	}
+	for _, id := range ids {
+		pinSet, err := oldCatalog.LoadPinSet(id)
+		if err != nil {
+			return len(keys), err
+		}
+		replacePinHashes(pinSet.Pins, newHashes)
+		newCatalog.SavePinSet(pinSet)
+	}
+	return len(keys), nil
+}
+
+// UpdateHashes replaces the hashes of snapshots, in the history of every source and in the pinsets,
+// by newHashes, by their old hash, for backups whose envelopes were republished under the same key.
+// It returns the number of sources updated.
+func (catalog *Catalog) UpdateHashes(newHashes map[string]string) (int, error) {
+
+	histories, err := catalog.Sources()
+	if err != nil {
+		return 0, err
+	}
+	updated := 0
+	for _, history := range histories {
+		if replaceHashes(history.Snapshots, newHashes) {
+			catalog.Save(history)
+			updated++
+		}
+	}
+
+	ids, err := catalog.PinSetIDs()
+	if err != nil {
+		return updated, err
+	}
+	for _, id := range ids {
+		pinSet, err := catalog.LoadPinSet(id)
+		if err != nil {
+			return updated, err
+		}
+		if replacePinHashes(pinSet.Pins, newHashes) {
+			catalog.SavePinSet(pinSet)
+		}
+	}
+	return updated, nil
+}
+
+// Records reports whether a snapshot in the history of a source or in a pinset was shared under hash.
+func (catalog *Catalog) Records(hash string) (bool, error) {
+
+	histories, err := catalog.Sources()
+	if err != nil {
+		return false, err
+	}
+	for _, history := range histories {
+		for _, snapshot := range history.Snapshots {
+			if snapshot.Hash == hash {
+				return true, nil
+			}
+		}
+	}
+
+	ids, err := catalog.PinSetIDs()
+	if err != nil {
+		return false, err
+	}
+	for _, id := range ids {
+		pinSet, err := catalog.LoadPinSet(id)
+		if err != nil {
+			return false, err
+		}
+		for _, pin := range pinSet.Pins {
+			if pin.Snapshot.Hash == hash {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// replaceHashes replaces the hashes of snapshots found in newHashes and reports whether any was.
+func replaceHashes(snapshots []Snapshot, newHashes map[string]string) bool {
+	replaced := false
+	for i, snapshot := range snapshots {
+		if hash, ok := newHashes[snapshot.Hash]; ok {
+			snapshots[i].Hash = hash
+			replaced = true
+		}
+	}
+	return replaced
+}
+
+// replacePinHashes replaces the hashes of the snapshots of pins found in newHashes and reports whether any was.
+func replacePinHashes(pins []PinnedDAG, newHashes map[string]string) bool {
+	replaced := false
+	for i, pin := range pins {
+		if hash, ok := newHashes[pin.Snapshot.Hash]; ok {
+			pins[i].Snapshot.Hash = hash
+			replaced = true
+		}
+	}
+	return replaced
+}
+
+// Sources returns the history of every source in the catalog, in the order of their objects.
+func (catalog *Catalog) Sources() ([]SourceHistory, error) {
+	keys, err := catalog.objectKeys()
+	if err != nil {
+		return nil, err
+	}
+	histories := make([]SourceHistory, 0, len(keys))
+	for _, key := range keys {
+		history, err := catalog.loadObject(key)
+		if err != nil {
+			return nil, err
+		}
+		histories = append(histories, history)
+	}
+	return histories, nil
+}
+
+// objectKeys lists the keys of the catalog objects.
+func (catalog *Catalog) objectKeys() ([]string, error) {
+	var keys []string
+	objects := catalog.project.ListObjects(context.Background(), catalog.bucket, &uplink.ListObjectsOptions{Prefix: catalog.uploadPath + CatalogPrefix})
+	for objects.Next() {
+		if !objects.Item().IsPrefix {
+			keys = append(keys, objects.Item().Key)
+		}
+	}
+	if err := objects.Err(); err != nil {
+		return nil, fmt.Errorf("could not list catalog: %v", err)
+	}
+	return keys, nil
+}
+
+// Record appends a snapshot to the history.
+func (history *SourceHistory) Record(snapshot Snapshot) {
+	history.Snapshots = append(history.Snapshots, snapshot)
+}
+
+// Select returns the snapshot with the given version, counted from 1, or else the latest
+// snapshot taken at or before at; a zero at selects the latest snapshot.
+func (history SourceHistory) Select(version int, at time.Time) (Snapshot, int, error) {
+	if len(history.Snapshots) == 0 {
+		return Snapshot{}, 0, fmt.Errorf("no backups of %q in the catalog", history.Source)
+	}
+	if version != 0 {
+		if version < 1 || version > len(history.Snapshots) {
+			return Snapshot{}, 0, fmt.Errorf("%q has versions 1 to %d, not %d", history.Source, len(history.Snapshots), version)
+		}
+		return history.Snapshots[version-1], version, nil
+	}
+	for i := len(history.Snapshots) - 1; i >= 0; i-- {
+		if at.IsZero() || !history.Snapshots[i].Created.After(at) {
+			return history.Snapshots[i], i + 1, nil
+		}
+	}
+	return Snapshot{}, 0, fmt.Errorf("no backup of %q at %s, the first one is of %s", history.Source,
+		at.Format(time.RFC3339), history.Snapshots[0].Created.Format(time.RFC3339))
+}
+
+// ParseSnapshotTime parses the time a snapshot is selected at like ParseShareTime,
+// e.g. RFC3339 or -3d for three days ago, except that a day selects its end.
+func ParseSnapshotTime(value string, now time.Time) (time.Time, error) {
+	if day, err := time.ParseInLocation(dayLayout, strings.TrimSpace(value), time.Local); err == nil {
+		return day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+	return ParseShareTime(value, now)
+}
+
+// Latest returns the most recent snapshot, or nil when there is none.
+func (history SourceHistory) Latest() *Snapshot {
+	if len(history.Snapshots) == 0 {
+		return nil
+	}
+	return &history.Snapshots[len(history.Snapshots)-1]
+}
+
+// Find returns the snapshot of the backup with the given base CID, or nil.
+func (history SourceHistory) Find(baseCID string) *Snapshot {
+	for i := len(history.Snapshots) - 1; i >= 0; i-- {
+		if history.Snapshots[i].BaseCID == baseCID {
+			return &history.Snapshots[i]
+		}
+	}
+	return nil
+}
+
+// Pointer returns the pointer of the backup of a snapshot in the given bucket.
+func (snapshot Snapshot) Pointer(bucket string) BackupPointer {
+	return BackupPointer{
+		Version:    EnvelopeVersion,
+		BaseCID:    snapshot.BaseCID,
+		Name:       snapshot.Name,
+		ID:         snapshot.ID,
+		Bucket:     bucket,
+		UploadPath: snapshot.UploadPath,
+		FileName:   snapshot.FileName,
+		DataKey:    snapshot.DataKey,
+		Signature:  snapshot.Signature,
+	}
+}
+
+// NewSnapshot returns the snapshot of a backup just stored with the configured location.
+func NewSnapshot(storjConfig ConfigStorj, manifest Manifest, hash string, dataKey []byte, signature *ManifestSignature) Snapshot {
+	return Snapshot{
+		BaseCID:    manifest.BaseCID,
+		Name:       manifest.Name,
+		ID:         manifest.ID,
+		Hash:       hash,
+		UploadPath: storjConfig.UploadPath,
+		FileName:   manifest.FileName,
+		Size:       manifest.Size,
+		Chunks:     len(manifest.Chunks),
+		Reused:     manifest.ReusedChunks(),
+		Created:    time.Now(),
+		DataKey:    dataKey,
+		Signature:  signature,
+	}
+}
+
+// SourceLabel returns the name snapshots of the source at path are recorded under:
+// the absolute path of local files and the path itself for /ipfs/ paths.
+// Stdin has no name, it has to be given with --source.
+func SourceLabel(path string) (string, error) {
+	if path == StdinSource {
+		return "", errors.New("data read from stdin needs a source name, set it with --source")
+	}
+	if strings.HasPrefix(path, "/ipfs/") {
+		return path, nil
+	}
+	return filepath.Abs(path)
+}
+
+// DownloadSnapshot restores a version of source, selected by version or the time at, from the catalog.
+// The progress callback may be nil.
+func DownloadSnapshot(project *uplink.Project, configStorj ConfigStorj, downloadConfigStorj DownloadConfigStorj,
+	source string, version int, at string, progress ProgressFunc) DownloadResult {
+
+	atTime, err := ParseSnapshotTime(at, time.Now())
+	if err != nil {
+		log.Fatal("Invalid --at: ", err)
+	}
+
+	catalog, err := OpenCatalog(project, configStorj, downloadConfigStorj.Key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	history, err := catalog.Load(source)
+	if err != nil {
+		log.Fatal(err)
+	}
+	snapshot, version, err := history.Select(version, atTime)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(statusOut, "\nRestoring version %d of %s, backed up %s\n", version, source, snapshot.Created.Format("2006-01-02 15:04:05"))
+
+	result := RestoreBackup(project, downloadConfigStorj, snapshot.Pointer(configStorj.Bucket), progress)
+	result.Source = source
+	result.Version = version
+	return result
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSourceHistorySelect(t *testing.T) {
+	day := func(d, hour int) time.Time {
+		return time.Date(2026, 10, d, hour, 0, 0, 0, time.UTC)
+	}
+	history := SourceHistory{Source: "/data.img", Snapshots: []Snapshot{
+		{BaseCID: "QmFirst", Created: day(10, 9)},
+		{BaseCID: "QmSecond", Created: day(12, 9)},
+		{BaseCID: "QmThird", Created: day(12, 18)},
+	}}
+
+	tests := []struct {
+		name    string
+		version int
+		at      time.Time
+		want    int
+		err     string
+	}{
+		{name: "latest", want: 3},
+		{name: "first version", version: 1, want: 1},
+		{name: "last version", version: 3, want: 3},
+		{name: "version too high", version: 4, err: "versions 1 to 3, not 4"},
+		{name: "negative version", version: -1, err: "versions 1 to 3, not -1"},
+		{name: "version wins over time", version: 2, at: day(10, 12), want: 2},
+		{name: "at a snapshot", at: day(12, 9), want: 2},
+		{name: "between snapshots", at: day(11, 0), want: 1},
+		{name: "after the last", at: day(20, 0), want: 3},
+		{name: "before the first", at: day(10, 8), err: "no backup of \"/data.img\" at 2026-10-10T08:00:00Z"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snapshot, version, err := history.Select(test.version, test.at)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("selected version %d, %v, want an error with %q", version, err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != test.want || snapshot.BaseCID != history.Snapshots[test.want-1].BaseCID {
+				t.Fatalf("selected version %d (%s), want %d", version, snapshot.BaseCID, test.want)
+			}
+		})
+	}
+
+	if _, _, err := (SourceHistory{Source: "/empty"}).Select(0, time.Time{}); err == nil {
+		t.Fatal("selected from an empty history")
+	}
+}
+
+func TestParseSnapshotTime(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{value: "2026-10-13", want: time.Date(2026, 10, 14, 0, 0, 0, 0, time.Local).Add(-time.Nanosecond)},
+		{value: " 2026-10-13 ", want: time.Date(2026, 10, 14, 0, 0, 0, 0, time.Local).Add(-time.Nanosecond)},
+		{value: "2026-10-13T08:30:00Z", want: time.Date(2026, 10, 13, 8, 30, 0, 0, time.UTC)},
+		{value: "-3d", want: now.AddDate(0, 0, -3)},
+		{value: "-12h", want: now.Add(-12 * time.Hour)},
+	}
+	for _, test := range tests {
+		got, err := ParseSnapshotTime(test.value, now)
+		if err != nil {
+			t.Errorf("%q: %v", test.value, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("%q: got %s, want %s", test.value, got, test.want)
+		}
+	}
+
+	for _, value := range []string{"yesterday", "2026-10-32", "13.10.2026"} {
+		if got, err := ParseSnapshotTime(value, now); err == nil {
+			t.Errorf("%q: got %s, want an error", value, got)
+		}
+	}
+}
+
+func TestReplaceHashes(t *testing.T) {
+	newHashes := map[string]string{"QmOld1": "QmNew1", "QmOld2": "QmNew2"}
+
+	snapshots := []Snapshot{{Hash: "QmOld1"}, {Hash: "QmOther"}, {Hash: "QmOld2"}}
+	if !replaceHashes(snapshots, newHashes) {
+		t.Fatal("reported no replacement")
+	}
+	for i, want := range []string{"QmNew1", "QmOther", "QmNew2"} {
+		if snapshots[i].Hash != want {
+			t.Errorf("snapshot %d has hash %s, want %s", i, snapshots[i].Hash, want)
+		}
+	}
+	if replaceHashes(snapshots, newHashes) {
+		t.Fatal("replaced hashes twice")
+	}
+
+	pins := []PinnedDAG{{Snapshot: Snapshot{Hash: "QmOther"}}, {Snapshot: Snapshot{Hash: "QmOld2"}}}
+	if !replacePinHashes(pins, newHashes) || pins[0].Snapshot.Hash != "QmOther" || pins[1].Snapshot.Hash != "QmNew2" {
+		t.Fatalf("replaced pin hashes: %+v", pins)
+	}
+	if replacePinHashes(pins, map[string]string{}) {
+		t.Fatal("replaced pin hashes without new hashes")
+	}
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+
+	shell "github.com/ipfs/go-ipfs-api"
+	"storj.io/uplink"
+)
+
+// DAGSourcePrefix marks DAGs, by root CID, among the sources of the catalog.
+const DAGSourcePrefix = "dag:"
+
+// carV2Pragma starts every CARv2 file, it reads as a CARv1 header of version 2.
+var carV2Pragma = []byte{0x0a, 0xa1, 0x67, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x02}
+
+// carV2HeaderSize is the size of the CARv2 header following the pragma.
+const carV2HeaderSize = 40
+
+// StoreDAG backs up the CAR export of the DAG below root and returns the snapshot of the backup.
+// The data key is generated here, options only select the chunk size and progress.
+func StoreDAG(project *uplink.Project, ipfsShell *shell.Shell, storjConfig ConfigStorj, root string, options StoreOptions,
+	recipients []Recipient, signingKey *SigningKey) Snapshot {
+
+	export, err := ExportDAG(ipfsShell, root)
+	if err != nil {
+		log.Fatalf("Could not export DAG %s: %v", root, err)
+	}
+
+	options.DataKey, err = NewDataKey()
+	if err != nil {
+		log.Fatal("Could not generate data key: ", err)
+	}
+	manifest := StoreData(ipfsShell, project, storjConfig, export, options)
+	if err = export.Close(); err != nil {
+		log.Fatalf("Could not export DAG %s: %v", root, err)
+	}
+	manifest.FileName = DAGFileName(root)
+	manifest.Source = DAGSourcePrefix + root
+	manifest.DAG = &ManifestDAG{Root: root, Format: DAGFormatCARv1}
+
+	envelope, hash := PublishBackup(project, ipfsShell, storjConfig, recipients, signingKey, options.DataKey, manifest)
+	return NewSnapshot(storjConfig, manifest, hash, options.DataKey, envelope.Signature)
+}
+
+// DAGFileName is the name backups of the DAG below root are restored as.
+func DAGFileName(root string) string {
+	return root + ".car"
+}
+
+// RestoreDAG imports the backup of the DAG below root into the node behind ipfsShell.
+// It returns the size of the imported export. The progress callback may be nil.
+func RestoreDAG(project *uplink.Project, ipfsShell *shell.Shell, pointer BackupPointer, root string, progress ProgressFunc) (int64, error) {
+
+	manifest := ReadManifest(project, pointer)
+	if manifest.DAG == nil || manifest.DAG.Root != root {
+		return 0, fmt.Errorf("backup %s is not an export of the DAG %s", pointer.BaseCID, root)
+	}
+	return ImportBackupDAG(project, ipfsShell, pointer, manifest, progress)
+}
+
+// ImportBackupDAG imports the DAG exported in a backup into the node behind ipfsShell with dag import,
+// while it is being downloaded. The blocks, and so every CID, are the ones that were exported.
+func ImportBackupDAG(project *uplink.Project, ipfsShell *shell.Shell, pointer BackupPointer, manifest Manifest, progress ProgressFunc) (int64, error) {
+
+	if manifest.DAG.Format != DAGFormatCARv1 {
+		return 0, fmt.Errorf("unsupported DAG export format %q", manifest.DAG.Format)
+	}
+
+	var tracker *ProgressTracker
+	if progress != nil {
+		tracker = NewProgressTracker("import", StoredSize(project, pointer, manifest), len(manifest.Chunks), progress)
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	imported := make(chan error, 1)
+	go func() {
+		err := ImportDAG(ipfsShell, pipeReader)
+		_ = pipeReader.CloseWithError(err)
+		imported <- err
+	}()
+
+	restored, err := RestoreChunks(project, pointer, manifest.Chunks, pipeWriter, tracker)
+	_ = pipeWriter.CloseWithError(err)
+	if importErr := <-imported; err == nil && importErr != nil {
+		err = fmt.Errorf("could not import DAG %s: %v", manifest.DAG.Root, importErr)
+	}
+	if err != nil {
+		return restored, err
+	}
+	tracker.Finish()
+	return restored, nil
+}
+
+// CARv2Header returns the pragma and header that turn a CARv1 stream of dataSize bytes into a CARv2 file.
+// The file has no index, readers that need one build it from the data.
+func CARv2Header(dataSize int64) []byte {
+	header := make([]byte, len(carV2Pragma)+carV2HeaderSize)
+	copy(header, carV2Pragma)
+
+	// The characteristics, 16 bytes, are left empty. The data follows the header, the index offset is zero.
+	fields := header[len(carV2Pragma)+16:]
+	binary.LittleEndian.PutUint64(fields[0:8], uint64(len(header)))
+	binary.LittleEndian.PutUint64(fields[8:16], uint64(dataSize))
+	return header
+}
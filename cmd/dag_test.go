@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestCARv2Header(t *testing.T) {
+	for _, dataSize := range []int64{0, 1234, 1 << 40} {
+		header := CARv2Header(dataSize)
+		if len(header) != 11+40 {
+			t.Fatalf("header of %d bytes, want 51", len(header))
+		}
+
+		// The pragma reads as a CARv1 header: a varint length and the CBOR map {"version": 2}.
+		pragma := header[:11]
+		if int(pragma[0]) != len(pragma)-1 {
+			t.Fatalf("pragma length %d, want %d", pragma[0], len(pragma)-1)
+		}
+		if want := append([]byte{0xa1, 0x67}, append([]byte("version"), 0x02)...); !bytes.Equal(pragma[1:], want) {
+			t.Fatalf("pragma %x, want %x", pragma[1:], want)
+		}
+
+		fields := header[11:]
+		if !bytes.Equal(fields[:16], make([]byte, 16)) {
+			t.Fatalf("characteristics %x, want none", fields[:16])
+		}
+		if offset := binary.LittleEndian.Uint64(fields[16:24]); offset != uint64(len(header)) {
+			t.Fatalf("data offset %d, want %d", offset, len(header))
+		}
+		if size := binary.LittleEndian.Uint64(fields[24:32]); size != uint64(dataSize) {
+			t.Fatalf("data size %d, want %d", size, dataSize)
+		}
+		if index := binary.LittleEndian.Uint64(fields[32:40]); index != 0 {
+			t.Fatalf("index offset %d, want none", index)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Overwrite policies applied when the restore destination already exists.
+const (
+	OverwriteFail      = "fail"
+	OverwriteOverwrite = "overwrite"
+	OverwriteRename    = "rename"
+	OverwriteSkip      = "skip"
+)
+
+// StdoutDestination is the download path that streams the restored data to stdout.
+const StdoutDestination = "-"
+
+// errSkipDestination is returned by ResolveDestination when the destination
+// exists and the overwrite policy asks to leave it untouched.
+var errSkipDestination = errors.New("destination exists, skipping")
+
+// ValidateOverwritePolicy checks that policy is one of the overwrite policies, or empty for the default.
+func ValidateOverwritePolicy(policy string) error {
+	switch policy {
+	case "", OverwriteFail, OverwriteOverwrite, OverwriteRename, OverwriteSkip:
+		return nil
+	}
+	return fmt.Errorf("unknown overwrite policy %q (expected %s, %s, %s or %s)",
+		policy, OverwriteFail, OverwriteOverwrite, OverwriteRename, OverwriteSkip)
+}
+
+// ResolveDestination works out the file a restore must be written to.
+// The configured path is treated as a directory when it already is one or
+// ends with a path separator, in which case the original file name is appended.
+// Parent directories are created and the overwrite policy is applied.
+func ResolveDestination(downloadPath string, fileName string, policy string) (string, error) {
+	destination, _, err := resolveDestination(downloadPath, fileName, policy)
+	return destination, err
+}
+
+// resolveDestination is ResolveDestination, it also returns the destination before it was renamed.
+func resolveDestination(downloadPath string, fileName string, policy string) (string, string, error) {
+
+	if err := ValidateOverwritePolicy(policy); err != nil {
+		return "", "", err
+	}
+	if downloadPath == "" {
+		downloadPath = "."
+	}
+
+	destination := downloadPath
+	info, err := os.Stat(downloadPath)
+	if (err == nil && info.IsDir()) || strings.HasSuffix(downloadPath, "/") || strings.HasSuffix(downloadPath, string(os.PathSeparator)) {
+		destination = filepath.Join(downloadPath, fileName)
+	}
+	destination = filepath.Clean(destination)
+
+	// Create the parent directories of the destination.
+	if err = os.MkdirAll(filepath.Dir(destination), 0750); err != nil {
+		return "", "", fmt.Errorf("could not create destination directory: %v", err)
+	}
+
+	info, err = os.Stat(destination)
+	if os.IsNotExist(err) {
+		return destination, destination, nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if info.IsDir() {
+		return "", "", fmt.Errorf("destination %q is a directory", destination)
+	}
+
+	switch policy {
+	case OverwriteOverwrite:
+		return destination, destination, nil
+	case OverwriteRename:
+		renamed, err := renameDestination(destination)
+		return renamed, destination, err
+	case OverwriteSkip:
+		return destination, destination, errSkipDestination
+	}
+	return "", "", fmt.Errorf("destination %q already exists (use --overwrite to choose a policy)", destination)
+}
+
+// renameDestination returns the first free "name (N).ext" variant of destination.
+// Nothing is reserved, the restore takes the name when it commits, see AtomicFile.
+func renameDestination(destination string) (string, error) {
+	ext := filepath.Ext(destination)
+	base := strings.TrimSuffix(destination, ext)
+	for i := 1; i < 10000; i++ {
+		candidate := base + " (" + strconv.Itoa(i) + ")" + ext
+		_, err := os.Lstat(candidate)
+		if os.IsNotExist(err) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("could not find a free name for %q", destination)
+}
+
+// RestoreWriter receives the decrypted data of a restore.
+// Commit is called once all data was written, Abort when the restore failed.
+// Destination describes where the data ends up, it is final once committed.
+type RestoreWriter interface {
+	io.Writer
+	Commit() error
+	Abort()
+	Destination() string
+}
+
+// OpenRestoreWriter returns the writer for a restore of fileName into downloadPath
+// together with a description of where the data ends up.
+func OpenRestoreWriter(downloadPath string, fileName string, policy string) (RestoreWriter, string, error) {
+	if downloadPath == StdoutDestination {
+		return stdoutWriter{os.Stdout}, "stdout", nil
+	}
+
+	destination, original, err := resolveDestination(downloadPath, fileName, policy)
+	if err != nil {
+		return nil, destination, err
+	}
+	atomicFile, err := CreateAtomicFile(destination)
+	if err != nil {
+		return nil, destination, fmt.Errorf("could not create download file: %v", err)
+	}
+	if policy == OverwriteRename {
+		atomicFile.renameFrom = original
+	}
+	return atomicFile, destination, nil
+}
+
+// stdoutWriter streams restored data to stdout, nothing needs to be committed.
+type stdoutWriter struct {
+	io.Writer
+}
+
+// Commit implements RestoreWriter.
+func (stdoutWriter) Commit() error { return nil }
+
+// Abort implements RestoreWriter.
+func (stdoutWriter) Abort() {}
+
+// Destination implements RestoreWriter.
+func (stdoutWriter) Destination() string { return "stdout" }
+
+// AtomicFile writes to a temporary file next to its destination
+// and moves it into place only once Commit is called.
+// With renameFrom set, Commit never replaces a file: when the destination was taken meanwhile,
+// the next free "name (N).ext" variant of renameFrom is used instead.
+type AtomicFile struct {
+	*os.File
+	destination string
+	renameFrom  string
+}
+
+// CreateAtomicFile opens a temporary file in the directory of destination.
+func CreateAtomicFile(destination string) (*AtomicFile, error) {
+	dir, name := filepath.Split(destination)
+	if dir == "" {
+		dir = "."
+	}
+	tempFile, err := ioutil.TempFile(dir, "."+name+".tmp-")
+	if err != nil {
+		return nil, err
+	}
+	return &AtomicFile{File: tempFile, destination: destination}, nil
+}
+
+// Commit flushes the temporary file and renames it to its destination.
+func (f *AtomicFile) Commit() error {
+	if err := f.Sync(); err != nil {
+		f.Abort()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0640); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if f.renameFrom == "" {
+		return os.Rename(f.Name(), f.destination)
+	}
+
+	// A hard link fails instead of replacing a file that took the name since it was chosen.
+	for attempt := 0; attempt < 100; attempt++ {
+		err := os.Link(f.Name(), f.destination)
+		if err == nil {
+			return os.Remove(f.Name())
+		}
+		if !os.IsExist(err) {
+			_ = os.Remove(f.Name())
+			return err
+		}
+		if f.destination, err = renameDestination(f.renameFrom); err != nil {
+			_ = os.Remove(f.Name())
+			return err
+		}
+	}
+	_ = os.Remove(f.Name())
+	return fmt.Errorf("could not find a free name for %q", f.renameFrom)
+}
+
+// Destination implements RestoreWriter.
+func (f *AtomicFile) Destination() string {
+	return f.destination
+}
+
+// Abort closes and removes the temporary file, leaving the destination untouched.
+func (f *AtomicFile) Abort() {
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+}
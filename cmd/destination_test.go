@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveDestination(t *testing.T) {
+	dir, err := ioutil.TempDir("", "destination")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	existing := filepath.Join(dir, "data.img")
+	if err = ioutil.WriteFile(existing, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "data (1).img"), []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		downloadPath string
+		policy       string
+		want         string
+		wantErr      error
+		fails        bool
+	}{
+		{name: "new file", downloadPath: filepath.Join(dir, "new.img"), want: filepath.Join(dir, "new.img")},
+		{name: "directory", downloadPath: dir, policy: OverwriteOverwrite, want: existing},
+		{name: "missing directory", downloadPath: filepath.Join(dir, "sub") + "/", want: filepath.Join(dir, "sub", "data.img")},
+		{name: "fail by default", downloadPath: existing, fails: true},
+		{name: "fail", downloadPath: existing, policy: OverwriteFail, fails: true},
+		{name: "overwrite", downloadPath: existing, policy: OverwriteOverwrite, want: existing},
+		{name: "rename", downloadPath: existing, policy: OverwriteRename, want: filepath.Join(dir, "data (2).img")},
+		{name: "rename reserves nothing", downloadPath: existing, policy: OverwriteRename, want: filepath.Join(dir, "data (2).img")},
+		{name: "skip", downloadPath: existing, policy: OverwriteSkip, want: existing, wantErr: errSkipDestination},
+		{name: "unknown policy", downloadPath: existing, policy: "merge", fails: true},
+		{name: "unknown policy without collision", downloadPath: filepath.Join(dir, "new.img"), policy: "merge", fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ResolveDestination(test.downloadPath, "data.img", test.policy)
+			if test.fails {
+				if err == nil {
+					t.Fatalf("got %q, want an error", got)
+				}
+				return
+			}
+			if err != test.wantErr {
+				t.Fatalf("got error %v, want %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	data, err := ioutil.ReadFile(existing)
+	if err != nil || string(data) != "data" {
+		t.Fatalf("existing file changed: %q, %v", data, err)
+	}
+}
+
+func TestRestoreWriterRename(t *testing.T) {
+	dir, err := ioutil.TempDir("", "destination")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	existing := filepath.Join(dir, "data.img")
+	if err = ioutil.WriteFile(existing, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// An aborted restore leaves nothing behind, the next one gets the same name.
+	writer, destination, err := OpenRestoreWriter(existing, "", OverwriteRename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Abort()
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("aborted restore left %d files", len(files)-1)
+	}
+	if again, _ := ResolveDestination(existing, "", OverwriteRename); again != destination {
+		t.Fatalf("renamed to %q after an abort, want %q", again, destination)
+	}
+
+	// A file that takes the chosen name before the restore commits is not replaced.
+	writer, destination, err = OpenRestoreWriter(existing, "", OverwriteRename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(destination, []byte("other"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = writer.Write([]byte("restored")); err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "data (2).img"); writer.Destination() != want {
+		t.Fatalf("committed to %q, want %q", writer.Destination(), want)
+	}
+	for name, want := range map[string]string{"data.img": "data", "data (1).img": "other", "data (2).img": "restored"} {
+		if data, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != want {
+			t.Fatalf("%s is %q, %v, want %q", name, data, err, want)
+		}
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 3 {
+		t.Fatalf("restore left %d files, want 3", len(files))
+	}
+}
@@ -0,0 +1,392 @@
+package cmd
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// EnvelopeVersion is the version of the pointer envelope and manifest written by store.
+// Backups written before envelopes were introduced have no version.
+const EnvelopeVersion = 1
+
+// DataKeySize is the size of the random per-backup data key.
+const DataKeySize = 32
+
+// Parameters of the scrypt derivation of key-encryption keys from the user's key.
+const (
+	kekSaltSize = 16
+	kekScryptN  = 1 << 15
+	kekScryptR  = 8
+	kekScryptP  = 1
+)
+
+// Envelope is the record published to IPFS behind the shareable hash of a backup.
+// The location and the manifest are sealed with the data key, which itself is
+// only stored wrapped under the key-encryption key derived from the user's key
+// and/or encrypted to the public keys of recipients.
+// Signed backups carry the signature of their manifest.
+type Envelope struct {
+	Version    int                `json:"version"`
+	BaseCID    string             `json:"baseCID"`
+	ID         string             `json:"id,omitempty"`
+	WrappedKey *WrappedKey        `json:"wrappedKey,omitempty"`
+	Recipients []RecipientStanza  `json:"recipients,omitempty"`
+	Location   []byte             `json:"location"`
+	Signature  *ManifestSignature `json:"signature,omitempty"`
+
+	// Private envelopes are never published to IPFS, only kept in the bucket, see SaveEnvelope.
+	Private bool `json:"private,omitempty"`
+}
+
+// StoredObject returns the key, below the upload path, of the copy of the envelope kept in the bucket.
+func (envelope Envelope) StoredObject() string {
+	return envelope.BaseCID + "/" + metadataName(envelope.ID, envelope.BaseCID) + EnvelopeSuffix
+}
+
+// Credentials are the secrets an envelope can be opened with.
+type Credentials struct {
+	Key        string
+	Identities []*Identity
+}
+
+// Empty reports whether no secret is available.
+func (credentials Credentials) Empty() bool {
+	return credentials.Key == "" && len(credentials.Identities) == 0
+}
+
+// BackupLocation is the Storj location of a backup, sealed inside its envelope.
+type BackupLocation struct {
+	Bucket     string `json:"bucket"`
+	UploadPath string `json:"uploadPath"`
+	FileName   string `json:"fileName"`
+
+	// BaseCID and Name are set when the envelope is stored under the name of the backup instead of
+	// its base CID, which then only appears here, encrypted.
+	BaseCID string `json:"baseCID,omitempty"`
+	Name    string `json:"name,omitempty"`
+}
+
+// WrappedKey is a data key encrypted under a key-encryption key.
+type WrappedKey struct {
+	Salt []byte `json:"salt"`
+	Key  []byte `json:"key"`
+}
+
+// Manifest lists the chunks of a backup in order. It is stored sealed with the data key.
+type Manifest struct {
+	Version  int             `json:"version"`
+	BaseCID  string          `json:"baseCID"`
+	FileName string          `json:"fileName"`
+	Source   string          `json:"source,omitempty"`
+	Size     int64           `json:"size"`
+	Chunks   []ManifestChunk `json:"chunks"`
+	MFS      *MFSTree        `json:"mfs,omitempty"`
+	DAG      *ManifestDAG    `json:"dag,omitempty"`
+
+	// Add are the parameters the base CID was computed with.
+	// Manifests written before they were recorded used the defaults of the daemon.
+	Add *AddParams `json:"add,omitempty"`
+
+	// Name is the name the objects of the backup are stored under in place of the base CID: the ID of new backups,
+	// an HMAC of the base CID for some earlier ones.
+	Name string `json:"name,omitempty"`
+
+	// ID names the objects, manifest and envelope of the backup, see NewBackupID.
+	ID string `json:"id,omitempty"`
+
+	// Digest is the SHA-256 of the stored manifest, it is what signatures cover.
+	Digest []byte `json:"-"`
+}
+
+// DAGFormatCARv1 is the format of backups of DAGs exported with dag export.
+const DAGFormatCARv1 = "car-v1"
+
+// ManifestDAG describes a backup whose data is the export of the DAG below Root, in Format.
+// It is restored by importing it into a node, which reproduces every block and CID.
+type ManifestDAG struct {
+	Root   string `json:"root"`
+	Format string `json:"format"`
+}
+
+// ManifestChunk is one encrypted chunk of a backup.
+// SHA256 is the digest of the stored, encrypted chunk and PlainSHA256 the digest of its content,
+// by which incremental backups recognize unchanged chunks.
+// Chunks reused from an earlier backup name their object and the data key it is sealed with,
+// so that the backup restores without the one it reuses them from.
+type ManifestChunk struct {
+	CID         string `json:"cid"`
+	Size        int64  `json:"size"`
+	SHA256      []byte `json:"sha256,omitempty"`
+	PlainSHA256 []byte `json:"plainSHA256,omitempty"`
+	Object      string `json:"object,omitempty"`
+	Name        string `json:"name,omitempty"`
+	DataKey     []byte `json:"dataKey,omitempty"`
+}
+
+// sealOverhead is the size SealData adds to the data: the GCM nonce and tag.
+const sealOverhead = 12 + 16
+
+// ObjectKey returns the key of the object the chunk is stored in.
+func (chunk ManifestChunk) ObjectKey(pointer BackupPointer) string {
+	if chunk.Object != "" {
+		return chunk.Object
+	}
+	if chunk.Name != "" {
+		return pointer.Prefix() + chunk.Name
+	}
+	return pointer.Prefix() + chunk.CID
+}
+
+// ObjectName returns the name the objects of the backup are stored under.
+func (manifest Manifest) ObjectName() string {
+	if manifest.Name != "" {
+		return manifest.Name
+	}
+	return manifest.BaseCID
+}
+
+// ManifestObject returns the key of the manifest below the upload path.
+func (manifest Manifest) ManifestObject() string {
+	return manifest.ObjectName() + "/" + metadataName(manifest.ID, manifest.ObjectName()) + ManifestSuffix
+}
+
+// ReusedChunks returns the number of chunks stored by earlier backups.
+func (manifest Manifest) ReusedChunks() int {
+	reused := 0
+	for _, chunk := range manifest.Chunks {
+		if chunk.Object != "" {
+			reused++
+		}
+	}
+	return reused
+}
+
+// ReferencedPrefixes returns the prefixes of the earlier backups chunks are reused from.
+func (manifest Manifest) ReferencedPrefixes() []string {
+	var prefixes []string
+	seen := map[string]bool{}
+	for _, chunk := range manifest.Chunks {
+		if chunk.Object == "" {
+			continue
+		}
+		prefix := chunk.Object[:strings.LastIndex(chunk.Object, "/")+1]
+		if !seen[prefix] {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// ReusableChunks indexes the chunks of the backup behind pointer by their content,
+// as references an incremental backup can store instead of uploading them again.
+func ReusableChunks(pointer BackupPointer, manifest Manifest) map[string]ManifestChunk {
+	reusable := map[string]ManifestChunk{}
+	for _, chunk := range manifest.Chunks {
+		if chunk.PlainSHA256 == nil || chunk.SHA256 == nil {
+			continue
+		}
+		if chunk.Object == "" {
+			chunk.Object = chunk.ObjectKey(pointer)
+			chunk.Name = ""
+			chunk.DataKey = pointer.DataKey
+		}
+		reusable[hex.EncodeToString(chunk.PlainSHA256)] = chunk
+	}
+	return reusable
+}
+
+// NewDataKey generates a random data key for a backup.
+func NewDataKey() ([]byte, error) {
+	dataKey := make([]byte, DataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	return dataKey, nil
+}
+
+// NewBackupID generates the random ID of a backup. The objects of the backup are stored below it,
+// so that they can be uploaded before the base CID is known and storing an input again leaves earlier backups intact.
+func NewBackupID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// SealData encrypts and authenticates data with AES-GCM.
+// The random nonce is prepended to the returned ciphertext.
+func SealData(key, data []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// OpenData decrypts data sealed with SealData and checks its integrity.
+func OpenData(key, sealed []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveKEK derives the key-encryption key from the user's key.
+func deriveKEK(secret string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(secret), salt, kekScryptN, kekScryptR, kekScryptP, DataKeySize)
+}
+
+// WrapKey encrypts dataKey under a key-encryption key derived from secret with a fresh salt.
+func WrapKey(secret string, dataKey []byte) (WrappedKey, error) {
+	salt := make([]byte, kekSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return WrappedKey{}, err
+	}
+	kek, err := deriveKEK(secret, salt)
+	if err != nil {
+		return WrappedKey{}, err
+	}
+	wrapped, err := SealData(kek, dataKey)
+	if err != nil {
+		return WrappedKey{}, err
+	}
+	return WrappedKey{Salt: salt, Key: wrapped}, nil
+}
+
+// UnwrapKey decrypts a data key wrapped with WrapKey.
+func UnwrapKey(secret string, wrapped WrappedKey) ([]byte, error) {
+	kek, err := deriveKEK(secret, wrapped.Salt)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := OpenData(kek, wrapped.Key)
+	if err != nil {
+		return nil, errors.New("could not unwrap the data key, wrong key?")
+	}
+	return dataKey, nil
+}
+
+// NewEnvelope seals the location of a backup, wraps its data key under secret
+// unless it is empty and encrypts it to every recipient.
+func NewEnvelope(secret string, recipients []Recipient, dataKey []byte, baseCID string, location BackupLocation) (Envelope, error) {
+	if secret == "" && len(recipients) == 0 {
+		return Envelope{}, errors.New("a key or at least one recipient is required")
+	}
+	envelope := Envelope{
+		Version: EnvelopeVersion,
+		BaseCID: baseCID,
+	}
+	if secret != "" {
+		wrapped, err := WrapKey(secret, dataKey)
+		if err != nil {
+			return Envelope{}, err
+		}
+		envelope.WrappedKey = &wrapped
+	}
+	stanzas, err := WrapForRecipients(recipients, dataKey)
+	if err != nil {
+		return Envelope{}, err
+	}
+	envelope.Recipients = stanzas
+
+	envelope.Location, err = sealJSON(dataKey, location)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return envelope, nil
+}
+
+// Open unwraps the data key of the envelope and decrypts the backup location.
+// The identities are tried on the recipient stanzas first, as that is cheap,
+// then the key on the wrapped key.
+func (envelope Envelope) Open(credentials Credentials) (BackupPointer, error) {
+	if envelope.Version != EnvelopeVersion {
+		return BackupPointer{}, fmt.Errorf("unsupported envelope version %d", envelope.Version)
+	}
+	if dataKey, ok := unwrapWithIdentities(credentials.Identities, envelope.Recipients); ok {
+		return envelope.pointer(dataKey)
+	}
+	if credentials.Key != "" && envelope.WrappedKey != nil {
+		dataKey, err := UnwrapKey(credentials.Key, *envelope.WrappedKey)
+		if err != nil {
+			return BackupPointer{}, err
+		}
+		return envelope.pointer(dataKey)
+	}
+	switch {
+	case len(credentials.Identities) > 0 && credentials.Key == "" && envelope.WrappedKey != nil:
+		return BackupPointer{}, errors.New("the backup is not encrypted to any of the identities, the key is needed")
+	case len(credentials.Identities) > 0:
+		return BackupPointer{}, errors.New("the backup is not encrypted to any of the identities")
+	default:
+		return BackupPointer{}, errors.New("the backup is only encrypted to recipients, an identity is needed")
+	}
+}
+
+// pointer decrypts the backup location with an already unwrapped data key.
+func (envelope Envelope) pointer(dataKey []byte) (BackupPointer, error) {
+	var location BackupLocation
+	if err := openJSON(dataKey, envelope.Location, &location); err != nil {
+		return BackupPointer{}, fmt.Errorf("could not decrypt backup location: %v", err)
+	}
+	pointer := BackupPointer{
+		Version:    envelope.Version,
+		BaseCID:    envelope.BaseCID,
+		Bucket:     location.Bucket,
+		UploadPath: location.UploadPath,
+		FileName:   location.FileName,
+		DataKey:    dataKey,
+		Signature:  envelope.Signature,
+		ID:         envelope.ID,
+	}
+	if location.BaseCID != "" {
+		pointer.BaseCID = location.BaseCID
+		pointer.Name = location.Name
+	}
+	return pointer, nil
+}
+
+// sealJSON marshals value and seals it with key.
+func sealJSON(key []byte, value interface{}) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return SealData(key, data)
+}
+
+// openJSON opens data sealed with sealJSON into value.
+func openJSON(key, sealed []byte, value interface{}) error {
+	data, err := OpenData(key, sealed)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestSealData(t *testing.T) {
+	key, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range [][]byte{{}, []byte("chunk"), bytes.Repeat([]byte{0xab}, 1<<16)} {
+		sealed, err := SealData(key, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sealed) != len(data)+sealOverhead {
+			t.Fatalf("sealed %d bytes into %d, want %d", len(data), len(sealed), len(data)+sealOverhead)
+		}
+		opened, err := OpenData(key, sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(opened, data) {
+			t.Fatalf("opened %d bytes, want %d", len(opened), len(data))
+		}
+	}
+
+	sealed, err := SealData(key, []byte("chunk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		key    []byte
+		sealed []byte
+	}{
+		{name: "wrong key", key: otherKey, sealed: sealed},
+		{name: "tampered nonce", key: key, sealed: flipBit(sealed, 0)},
+		{name: "tampered ciphertext", key: key, sealed: flipBit(sealed, 12)},
+		{name: "tampered tag", key: key, sealed: flipBit(sealed, len(sealed)-1)},
+		{name: "truncated", key: key, sealed: sealed[:len(sealed)-1]},
+		{name: "too short", key: key, sealed: sealed[:4]},
+		{name: "invalid key", key: key[:5], sealed: sealed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := OpenData(test.key, test.sealed); err == nil {
+				t.Fatal("opened, want an error")
+			}
+		})
+	}
+}
+
+func TestWrapKey(t *testing.T) {
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := WrapKey("correct horse", dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unwrapped, err := UnwrapKey("correct horse", wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(unwrapped, dataKey) {
+		t.Fatal("unwrapped another data key")
+	}
+
+	again, err := WrapKey("correct horse", dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(again.Salt, wrapped.Salt) {
+		t.Fatal("wrapping twice reused the salt")
+	}
+
+	tests := []struct {
+		name    string
+		secret  string
+		wrapped WrappedKey
+	}{
+		{name: "wrong key", secret: "battery staple", wrapped: wrapped},
+		{name: "empty key", secret: "", wrapped: wrapped},
+		{name: "other salt", secret: "correct horse", wrapped: WrappedKey{Salt: again.Salt, Key: wrapped.Key}},
+		{name: "tampered", secret: "correct horse", wrapped: WrappedKey{Salt: wrapped.Salt, Key: flipBit(wrapped.Key, 20)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := UnwrapKey(test.secret, test.wrapped); err == nil {
+				t.Fatal("unwrapped, want an error")
+			}
+		})
+	}
+}
+
+func TestEnvelopeOpen(t *testing.T) {
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope, err := NewEnvelope("correct horse", nil, dataKey, "QmBase", BackupLocation{
+		Bucket:     "backups",
+		UploadPath: "ipfs/",
+		FileName:   "data.img",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope.ID = "0123456789abcdef"
+
+	pointer, err := envelope.Open(Credentials{Key: "correct horse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pointer.BaseCID != "QmBase" || pointer.Bucket != "backups" || pointer.FileName != "data.img" || !bytes.Equal(pointer.DataKey, dataKey) {
+		t.Fatalf("opened %+v", pointer)
+	}
+	if want := "ipfs/QmBase/0123456789abcdef.manifest"; pointer.ManifestKey() != want {
+		t.Fatalf("manifest key %q, want %q", pointer.ManifestKey(), want)
+	}
+	if want := "QmBase/0123456789abcdef.envelope"; envelope.StoredObject() != want {
+		t.Fatalf("stored envelope %q, want %q", envelope.StoredObject(), want)
+	}
+
+	if _, err = envelope.Open(Credentials{Key: "battery staple"}); err == nil {
+		t.Fatal("opened with the wrong key")
+	}
+	if _, err = envelope.Open(Credentials{}); err == nil {
+		t.Fatal("opened without credentials")
+	}
+	envelope.Location = flipBit(envelope.Location, 20)
+	if _, err = envelope.Open(Credentials{Key: "correct horse"}); err == nil {
+		t.Fatal("opened a tampered location")
+	}
+	if _, err = NewEnvelope("", nil, dataKey, "QmBase", BackupLocation{}); err == nil {
+		t.Fatal("created an envelope nobody can open")
+	}
+}
+
+func TestNewBackupID(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		id, err := NewBackupID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(id) != 16 || seen[id] {
+			t.Fatalf("backup ID %q is not 16 random hex digits", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestReusableChunks(t *testing.T) {
+	earlierKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := SealData(previousKey, []byte("unchanged"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := func(data string) []byte {
+		sum := sha256.Sum256([]byte(data))
+		return sum[:]
+	}
+
+	previous := BackupPointer{Version: 1, BaseCID: "QmPrevious", Name: "previous", ID: "previous", UploadPath: "ipfs/", DataKey: previousKey}
+	manifest := Manifest{Chunks: []ManifestChunk{
+		// Stored by the previous backup under its CID and under an HMAC name.
+		{CID: "QmUnchanged", Size: 9, SHA256: digest(string(sealed)), PlainSHA256: digest("unchanged")},
+		{CID: "QmHidden", Name: "hmac", Size: 6, SHA256: digest("sealed"), PlainSHA256: digest("hidden")},
+		// Reused by the previous backup from an earlier one.
+		{CID: "QmEarlier", Size: 7, SHA256: digest("sealed"), PlainSHA256: digest("earlier"), Object: "ipfs/earlier/QmEarlier", DataKey: earlierKey},
+		// Stored before incremental backups recorded the digests of chunks.
+		{CID: "QmOld", Size: 3},
+	}}
+	if manifest.ReusedChunks() != 1 {
+		t.Fatalf("%d chunks reused, want 1", manifest.ReusedChunks())
+	}
+
+	reusable := ReusableChunks(previous, manifest)
+	if len(reusable) != 3 {
+		t.Fatalf("%d reusable chunks, want 3", len(reusable))
+	}
+	tests := []struct {
+		content string
+		object  string
+		dataKey []byte
+	}{
+		{content: "unchanged", object: "ipfs/previous/QmUnchanged", dataKey: previousKey},
+		{content: "hidden", object: "ipfs/previous/hmac", dataKey: previousKey},
+		{content: "earlier", object: "ipfs/earlier/QmEarlier", dataKey: earlierKey},
+	}
+	for _, test := range tests {
+		chunk, ok := reusable[hex.EncodeToString(digest(test.content))]
+		if !ok {
+			t.Fatalf("chunk %q is not reusable", test.content)
+		}
+		if chunk.Object != test.object || chunk.Name != "" || !bytes.Equal(chunk.DataKey, test.dataKey) {
+			t.Fatalf("chunk %q reused as %+v", test.content, chunk)
+		}
+	}
+
+	// A backup reusing the chunks restores them without the one it took them from.
+	current := BackupPointer{Version: 1, BaseCID: "QmCurrent", Name: "current", ID: "current", UploadPath: "ipfs/", DataKey: earlierKey}
+	chunk := reusable[hex.EncodeToString(digest("unchanged"))]
+	if chunk.ObjectKey(current) != "ipfs/previous/QmUnchanged" {
+		t.Fatalf("reused chunk is read from %s", chunk.ObjectKey(current))
+	}
+	data, err := current.decryptChunk(chunk, sealed)
+	if err != nil || string(data) != "unchanged" {
+		t.Fatalf("decrypted %q, %v", data, err)
+	}
+
+	next := Manifest{Chunks: []ManifestChunk{chunk, reusable[hex.EncodeToString(digest("earlier"))], {CID: "QmNew"}}}
+	if prefixes := next.ReferencedPrefixes(); len(prefixes) != 2 || prefixes[0] != "ipfs/previous/" || prefixes[1] != "ipfs/earlier/" {
+		t.Fatalf("referenced prefixes %q", prefixes)
+	}
+}
+
+// flipBit returns a copy of data with one bit of the byte at i flipped.
+func flipBit(data []byte, i int) []byte {
+	flipped := append([]byte(nil), data...)
+	flipped[i] ^= 0x01
+	return flipped
+}
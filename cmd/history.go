@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// historyCmd represents the history command.
+var historyCmd = &cobra.Command{
+	Use:   "history [source]",
+	Short: "Command to list the versions backed up of each source.",
+	Long: `Command to list the snapshots recorded in the catalog of sources for one source, or for all of them.
+A source is the absolute path of a backed up file, its /ipfs/ path or the name given with store --source.
+Any version is restored with download --source <name> and --version or --at.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  storjHistory,
+}
+
+// HistoryResult is the result of the history command.
+type HistoryResult struct {
+	Bucket  string          `json:"bucket"`
+	Sources []HistorySource `json:"sources"`
+}
+
+// HistorySource lists the versions of one source.
+type HistorySource struct {
+	Source   string           `json:"source"`
+	Versions []HistoryVersion `json:"versions"`
+}
+
+// HistoryVersion describes one snapshot of a source, without its data key.
+type HistoryVersion struct {
+	Version  int       `json:"version"`
+	Created  time.Time `json:"created"`
+	BaseCID  string    `json:"baseCID"`
+	Hash     string    `json:"hash"`
+	FileName string    `json:"fileName"`
+	Bytes    int64     `json:"bytes"`
+	Chunks   int       `json:"chunks"`
+	Reused   int       `json:"reused"`
+	Signer   string    `json:"signer,omitempty"`
+}
+
+func init() {
+
+	// Setup the history command with its flags.
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.Flags().BoolP("accesskey", "a", false, "Connect to storj using access key(default connection method is by using API Key).")
+	historyCmd.Flags().StringP("storj", "u", "././config/storj_config_v01.json", "full filepath contaning storj V3 configuration.")
+}
+
+func storjHistory(cmd *cobra.Command, args []string) {
+
+	// Process arguments from the CLI.
+	fullFileNameStorj, _ := cmd.Flags().GetString("storj")
+	useAccessKey, _ := cmd.Flags().GetBool("accesskey")
+
+	// Read storj network configurations from and external file and create a storj configuration object.
+	storjConfig := LoadStorjConfiguration(fullFileNameStorj)
+	if storjConfig.Key == "" {
+		storjConfig.Key = PromptKey(false)
+	}
+
+	// Connect to storj network using the specified credentials.
+	_, project := ConnectToStorj(fullFileNameStorj, storjConfig, useAccessKey)
+	defer func() {
+		_ = project.Close()
+	}()
+
+	catalog, err := OpenCatalog(project, storjConfig, storjConfig.Key)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var histories []SourceHistory
+	if len(args) == 1 {
+		history, err := catalog.Load(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(history.Snapshots) == 0 {
+			log.Fatalf("No backups of %q in the catalog", args[0])
+		}
+		histories = append(histories, history)
+	} else {
+		if histories, err = catalog.Sources(); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(statusOut, "\n%d sources in the catalog of %s/%s\n", len(histories), storjConfig.Bucket, storjConfig.UploadPath)
+	}
+
+	result := HistoryResult{Bucket: storjConfig.Bucket, Sources: []HistorySource{}}
+	for _, history := range histories {
+		fmt.Fprintf(statusOut, "\n%s\t%d versions\n", history.Source, len(history.Snapshots))
+		source := HistorySource{Source: history.Source, Versions: []HistoryVersion{}}
+		for i, snapshot := range history.Snapshots {
+			version := HistoryVersion{
+				Version:  i + 1,
+				Created:  snapshot.Created,
+				BaseCID:  snapshot.BaseCID,
+				Hash:     snapshot.Hash,
+				FileName: snapshot.FileName,
+				Bytes:    snapshot.Size,
+				Chunks:   snapshot.Chunks,
+				Reused:   snapshot.Reused,
+			}
+			if snapshot.Signature != nil {
+				version.Signer = FormatSigner(snapshot.Signature.PublicKey)
+			}
+			fmt.Fprintf(statusOut, "%d\t%s\t%s\t%s\t%d chunks (%d reused)\t%s\n", version.Version, version.Created.Format("2006-01-02 15:04:05"),
+				version.BaseCID, formatBytes(version.Bytes), version.Chunks, version.Reused, version.Hash)
+			source.Versions = append(source.Versions, version)
+		}
+		result.Sources = append(result.Sources, source)
+	}
+
+	PrintResult(result)
+}
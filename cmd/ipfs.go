@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,8 +12,10 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	shell "github.com/ipfs/go-ipfs-api"
+	files "github.com/ipfs/go-ipfs-files"
 )
 
 // ConfigIpfs defines the variables and types.
@@ -21,8 +24,97 @@ type ConfigIpfs struct {
 	Port      string `json:"port"`
 	Path      string `json:"path"`
 	ChunkSize string `json:"chunkSize"`
+
+	// Parameters of ipfs add the base CID of new backups is computed with, see AddParams.
+	CIDVersion   int    `json:"cidVersion"`
+	HashFunction string `json:"hashFunction"`
+	Chunker      string `json:"chunker"`
+	RawLeaves    *bool  `json:"rawLeaves"`
+	Trickle      bool   `json:"trickle"`
+
+	// IPNSKey names the key of the node the index of the latest backups is published under, see PublishIndex.
+	IPNSKey string `json:"ipnsKey"`
+}
+
+// Defaults of ipfs add, which the parameters of backups fall back to.
+const (
+	DefaultHashFunction = "sha2-256"
+	DefaultChunker      = "size-262144"
+)
+
+// AddParams are the parameters of ipfs add the base CID of a backup is computed with.
+// Adding the restored content with the same parameters reproduces the base CID.
+type AddParams struct {
+	CIDVersion   int    `json:"cidVersion"`
+	HashFunction string `json:"hashFunction"`
+	Chunker      string `json:"chunker"`
+	RawLeaves    bool   `json:"rawLeaves"`
+	Trickle      bool   `json:"trickle"`
 }
 
+// AddParams returns the configured parameters of ipfs add, completed with the defaults
+// of ipfs add instead of those of the daemon, so that they are known exactly.
+// As with ipfs add, raw leaves are used with CIDv1 unless configured otherwise.
+func (configIpfs ConfigIpfs) AddParams() AddParams {
+	params := AddParams{
+		CIDVersion:   configIpfs.CIDVersion,
+		HashFunction: configIpfs.HashFunction,
+		Chunker:      configIpfs.Chunker,
+		RawLeaves:    configIpfs.CIDVersion == 1,
+		Trickle:      configIpfs.Trickle,
+	}
+	if params.CIDVersion != 0 && params.CIDVersion != 1 {
+		log.Fatalf("Invalid CID version %d, use 0 or 1", params.CIDVersion)
+	}
+	if params.HashFunction == "" {
+		params.HashFunction = DefaultHashFunction
+	}
+	if params.Chunker == "" {
+		params.Chunker = DefaultChunker
+	}
+	if configIpfs.RawLeaves != nil {
+		params.RawLeaves = *configIpfs.RawLeaves
+	}
+	return params
+}
+
+// Options returns the options of ipfs add selecting the parameters.
+func (params AddParams) Options() []shell.AddOpts {
+	return []shell.AddOpts{
+		shell.CidVersion(params.CIDVersion),
+		shell.Hash(params.HashFunction),
+		shell.RawLeaves(params.RawLeaves),
+		addOption("chunker", params.Chunker),
+		addOption("trickle", params.Trickle),
+	}
+}
+
+// String describes the parameters like the flags of ipfs add.
+func (params AddParams) String() string {
+	return fmt.Sprintf("--cid-version=%d --hash=%s --chunker=%s --raw-leaves=%t --trickle=%t",
+		params.CIDVersion, params.HashFunction, params.Chunker, params.RawLeaves, params.Trickle)
+}
+
+// AddOptions returns the options of ipfs add that reproduce the base CID of the backup,
+// none for manifests that did not record them.
+func (manifest Manifest) AddOptions() []shell.AddOpts {
+	if manifest.Add == nil {
+		return nil
+	}
+	return manifest.Add.Options()
+}
+
+// addOption sets an option of ipfs add the shell has no helper for.
+func addOption(name string, value interface{}) shell.AddOpts {
+	return func(rb *shell.RequestBuilder) error {
+		rb.Option(name, value)
+		return nil
+	}
+}
+
+// StdinSource is the input path that reads the data to back-up from stdin.
+const StdinSource = "-"
+
 // LoadIpfsProperty reads and parses the JSON file
 // that contain a IPFS instance's property.
 // and returns all the properties as an object.
@@ -46,10 +138,10 @@ func LoadIpfsProperty(fullFileName string) ConfigIpfs {
 	}
 
 	// Display read information.
-	fmt.Println("\nReading IPFS configuration from file: ", fullFileName, "file")
-	fmt.Println("Host Name\t: ", configIpfs.HostName)
-	fmt.Println("Port\t\t: ", configIpfs.Port)
-	fmt.Println("Upload File Path: ", configIpfs.Path)
+	fmt.Fprintln(statusOut, "\nReading IPFS configuration from file: ", fullFileName, "file")
+	fmt.Fprintln(statusOut, "Host Name\t: ", configIpfs.HostName)
+	fmt.Fprintln(statusOut, "Port\t\t: ", configIpfs.Port)
+	fmt.Fprintln(statusOut, "Upload File Path: ", configIpfs.Path)
 
 	return configIpfs
 }
@@ -59,7 +151,7 @@ func LoadIpfsProperty(fullFileName string) ConfigIpfs {
 // It returns a reference to an io.Reader with IPFS instance information.
 func ConnectToIpfs(configIpfs ConfigIpfs) *shell.Shell {
 
-	fmt.Println("\nConnecting to IPFS...")
+	fmt.Fprintln(statusOut, "\nConnecting to IPFS...")
 
 	if configIpfs.HostName == "ipfsHostName" || configIpfs.HostName == "" {
 		err1 := errors.New("Invalid HostName")
@@ -82,7 +174,7 @@ func ConnectToIpfs(configIpfs ConfigIpfs) *shell.Shell {
 		log.Fatal("Invalid Chunk size : ", err1)
 	}
 
-	fmt.Println("Successfully connected to IPFS!")
+	fmt.Fprintln(statusOut, "Successfully connected to IPFS!")
 
 	return sh
 }
@@ -104,12 +196,26 @@ func CreateCID(sh *shell.Shell, data []byte) string {
 	return encryptChunkCID
 }
 
+// PublishEnvelope adds the envelope of a backup to IPFS.
+// It returns the shareable hash of the envelope.
+func PublishEnvelope(sh *shell.Shell, envelope Envelope) string {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		log.Fatal(err)
+	}
+	configHash, err := sh.Add(bytes.NewReader(data))
+	if err != nil {
+		log.Fatal("Could not add configuration data to IPFS: ", err)
+	}
+	return configHash
+}
+
 // ConnectToIPFSForDownload will connect to a IPFS instance,
 // based on the hash name of file on IPFS.
 // It returns a reference to an io.Reader with IPFS instance information
 func ConnectToIPFSForDownload(hash string, hostName string, port string) *bytes.Reader {
 
-	fmt.Println("\nConnecting to IPFS...")
+	fmt.Fprintln(statusOut, "\nConnecting to IPFS...")
 	if hostName == "ipfsHostName" || hostName == "" {
 		err1 := errors.New("Invalid HostName")
 		log.Fatal(err1)
@@ -129,7 +235,7 @@ func ConnectToIPFSForDownload(hash string, hostName string, port string) *bytes.
 	}
 
 	// Inform about successful connection.
-	fmt.Println("\nSuccessfully connected to IPFS!")
+	fmt.Fprintln(statusOut, "\nSuccessfully connected to IPFS!")
 
 	// Get data from ipfs node.
 	fileReader, err := sh.Cat(hash)
@@ -143,9 +249,20 @@ func ConnectToIPFSForDownload(hash string, hostName string, port string) *bytes.
 	return reader
 }
 
-// GetReader returns a Reader of corresponding file whose path is specified.
+// GetReader returns a Reader of the source whose path is specified.
+// The path is a local file, - for stdin or an /ipfs/ path read from the node.
 // io.ReadCloser type of object returned is used to perform transfer of file to Storj.
 func GetReader(sh *shell.Shell, configIpfs ConfigIpfs) io.ReadCloser {
+	if configIpfs.Path == StdinSource {
+		return ioutil.NopCloser(os.Stdin)
+	}
+	if strings.HasPrefix(configIpfs.Path, "/ipfs/") {
+		ipfsReader, err := sh.Cat(configIpfs.Path)
+		if err != nil {
+			log.Fatal("IPFS data read error: ", err)
+		}
+		return ipfsReader
+	}
 	ipfsReader, err1 := os.Open(filepath.Clean(configIpfs.Path))
 	if err1 != nil {
 		err2 := errors.New("Invalid File path entered")
@@ -154,13 +271,34 @@ func GetReader(sh *shell.Shell, configIpfs ConfigIpfs) io.ReadCloser {
 	return ipfsReader
 }
 
+// SourceSize returns the size of a local source file, or zero when it is not known up front.
+func SourceSize(configIpfs ConfigIpfs) int64 {
+	if configIpfs.Path == StdinSource || strings.HasPrefix(configIpfs.Path, "/ipfs/") {
+		return 0
+	}
+	info, err := os.Stat(filepath.Clean(configIpfs.Path))
+	if err != nil || !info.Mode().IsRegular() {
+		return 0
+	}
+	return info.Size()
+}
+
+// SourceName returns the file name a backup of the given source is restored as.
+func SourceName(path string) string {
+	if path == StdinSource {
+		return "stdin"
+	}
+	_, lastFileName := filepath.Split(path)
+	return lastFileName
+}
+
 // GetReaderDownload returns a Reader of corresponding file whose path is specified.
 // io.ReadCloser type of object returned is used to perform transfer of file to Storj.
 func GetReaderDownload(sh *shell.Shell, hash string) *bytes.Reader {
 	// Get data from ipfs node.
 	fileReader, err := sh.Cat(hash)
 	if err != nil {
-		fmt.Println("IPFS data read error: ", err)
+		fmt.Fprintln(statusOut, "IPFS data read error: ", err)
 	}
 
 	// // Read all data recive from ipfs.
@@ -168,3 +306,57 @@ func GetReaderDownload(sh *shell.Shell, hash string) *bytes.Reader {
 	reader := bytes.NewReader(readbytes)
 	return reader
 }
+
+// IPFSAdder adds everything written to it to IPFS as one file.
+type IPFSAdder struct {
+	pipe   *io.PipeWriter
+	result chan addResult
+}
+
+type addResult struct {
+	cid string
+	err error
+}
+
+// NewIPFSAdder starts adding a file to the node behind sh with the given options.
+func NewIPFSAdder(sh *shell.Shell, options []shell.AddOpts) *IPFSAdder {
+	pipeReader, pipeWriter := io.Pipe()
+	adder := &IPFSAdder{pipe: pipeWriter, result: make(chan addResult, 1)}
+	go func() {
+		cid, err := sh.Add(pipeReader, options...)
+		_ = pipeReader.CloseWithError(err)
+		adder.result <- addResult{cid, err}
+	}()
+	return adder
+}
+
+// Write passes data on to the add.
+func (adder *IPFSAdder) Write(data []byte) (int, error) {
+	return adder.pipe.Write(data)
+}
+
+// Finish ends the file, or aborts the add when err is not nil, and returns the CID of the added file.
+func (adder *IPFSAdder) Finish(err error) (string, error) {
+	_ = adder.pipe.CloseWithError(err)
+	added := <-adder.result
+	return added.cid, added.err
+}
+
+// ExportDAG returns the CARv1 export of the DAG below cid, read from the node with dag export.
+func ExportDAG(sh *shell.Shell, cid string) (io.ReadCloser, error) {
+	response, err := sh.Request("dag/export", cid).Send(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		_ = response.Close()
+		return nil, response.Error
+	}
+	return response.Output, nil
+}
+
+// ImportDAG imports the blocks of a CAR stream into the node with dag import, which pins its roots.
+func ImportDAG(sh *shell.Shell, reader io.Reader) error {
+	body := files.NewMultiFileReader(files.NewSliceDirectory([]files.DirEntry{files.FileEntry("", files.NewReaderFile(reader))}), true)
+	return sh.Request("dag/import").Option("pin-roots", true).Body(body).Exec(context.Background(), nil)
+}
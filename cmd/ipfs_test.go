@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	shell "github.com/ipfs/go-ipfs-api"
+)
+
+func TestAddParams(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		name   string
+		config ConfigIpfs
+		want   AddParams
+	}{
+		{
+			name:   "defaults",
+			config: ConfigIpfs{},
+			want:   AddParams{CIDVersion: 0, HashFunction: "sha2-256", Chunker: "size-262144"},
+		},
+		{
+			name:   "cidv1 implies raw leaves",
+			config: ConfigIpfs{CIDVersion: 1},
+			want:   AddParams{CIDVersion: 1, HashFunction: "sha2-256", Chunker: "size-262144", RawLeaves: true},
+		},
+		{
+			name:   "cidv1 without raw leaves",
+			config: ConfigIpfs{CIDVersion: 1, RawLeaves: &disabled},
+			want:   AddParams{CIDVersion: 1, HashFunction: "sha2-256", Chunker: "size-262144"},
+		},
+		{
+			name:   "cidv0 with raw leaves",
+			config: ConfigIpfs{RawLeaves: &enabled},
+			want:   AddParams{CIDVersion: 0, HashFunction: "sha2-256", Chunker: "size-262144", RawLeaves: true},
+		},
+		{
+			name:   "configured",
+			config: ConfigIpfs{CIDVersion: 1, HashFunction: "blake2b-256", Chunker: "rabin-262144-524288-1048576", Trickle: true},
+			want:   AddParams{CIDVersion: 1, HashFunction: "blake2b-256", Chunker: "rabin-262144-524288-1048576", RawLeaves: true, Trickle: true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.config.AddParams(); got != test.want {
+				t.Fatalf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAddParamsOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		params AddParams
+		want   url.Values
+		flags  string
+	}{
+		{
+			// The defaults are sent too, so that the daemon's configuration does not change them.
+			name:   "defaults",
+			params: ConfigIpfs{}.AddParams(),
+			want: url.Values{"cid-version": {"0"}, "hash": {"sha2-256"}, "raw-leaves": {"false"},
+				"chunker": {"size-262144"}, "trickle": {"false"}},
+			flags: "--cid-version=0 --hash=sha2-256 --chunker=size-262144 --raw-leaves=false --trickle=false",
+		},
+		{
+			name:   "configured",
+			params: AddParams{CIDVersion: 1, HashFunction: "blake2b-256", Chunker: "size-1024", RawLeaves: true, Trickle: true},
+			want: url.Values{"cid-version": {"1"}, "hash": {"blake2b-256"}, "raw-leaves": {"true"},
+				"chunker": {"size-1024"}, "trickle": {"true"}},
+			flags: "--cid-version=1 --hash=blake2b-256 --chunker=size-1024 --raw-leaves=true --trickle=true",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var query url.Values
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query = r.URL.Query()
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"Name":"data","Hash":"QmHash","Size":"4"}`))
+			}))
+			defer server.Close()
+
+			if _, err := shell.NewShell(server.URL).Add(strings.NewReader("data"), test.params.Options()...); err != nil {
+				t.Fatal(err)
+			}
+			for option, want := range test.want {
+				if got := query[option]; len(got) != 1 || got[0] != want[0] {
+					t.Errorf("option %s is %q, want %q", option, got, want[0])
+				}
+			}
+			if got := test.params.String(); got != test.flags {
+				t.Errorf("described as %q, want %q", got, test.flags)
+			}
+		})
+	}
+
+	if options := (Manifest{}).AddOptions(); options != nil {
+		t.Fatalf("manifest without parameters has %d add options", len(options))
+	}
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	shell "github.com/ipfs/go-ipfs-api"
+)
+
+// IPNSPrefix starts the paths of IPNS names.
+const IPNSPrefix = "/ipns/"
+
+// errIndexNotResolved is returned by LoadIndex when the IPNS name does not resolve, e.g. as it was never published.
+var errIndexNotResolved = errors.New("could not resolve")
+
+// BackupIndex lists the latest backup of every source published under an IPNS name.
+// Sources are listed under the names given with --index-name, not under their sources in the catalog.
+// It is public: these names, the shareable hashes and the base CIDs can be read by anyone who knows the name,
+// the backups themselves still need the key or an identity.
+type BackupIndex struct {
+	Version   int                   `json:"version"`
+	Updated   time.Time             `json:"updated"`
+	Sources   map[string]IndexEntry `json:"sources"`
+	Signature *ManifestSignature    `json:"signature,omitempty"`
+}
+
+// IndexEntry is the latest backup of a source in a backup index.
+type IndexEntry struct {
+	Hash     string    `json:"hash"`
+	BaseCID  string    `json:"baseCID"`
+	FileName string    `json:"fileName"`
+	Created  time.Time `json:"created"`
+}
+
+// Digest returns the SHA-256 of the index without its signature, which is what signatures cover.
+func (index BackupIndex) Digest() []byte {
+	index.Signature = nil
+	data, err := json.Marshal(index)
+	if err != nil {
+		log.Fatal(err)
+	}
+	digest := sha256.Sum256(data)
+	return digest[:]
+}
+
+// IPNSName returns the IPNS path of the key named key in the keystore of the node.
+func IPNSName(sh *shell.Shell, key string) (string, error) {
+	var out struct {
+		Keys []struct {
+			Name string
+			ID   string `json:"Id"`
+		}
+	}
+	if err := sh.Request("key/list").Exec(context.Background(), &out); err != nil {
+		return "", fmt.Errorf("could not list IPNS keys: %v", err)
+	}
+	for _, entry := range out.Keys {
+		if entry.Name == key {
+			return IPNSPrefix + entry.ID, nil
+		}
+	}
+	return "", fmt.Errorf("no IPNS key %q on the node, create it with ipfs key gen", key)
+}
+
+// LoadIndex resolves an IPNS name, with or without /ipns/, and reads the backup index it points to.
+// A name that does not resolve fails with errIndexNotResolved.
+func LoadIndex(sh *shell.Shell, name string) (BackupIndex, error) {
+
+	var index BackupIndex
+
+	if !strings.HasPrefix(name, IPNSPrefix) {
+		name = IPNSPrefix + name
+	}
+	resolved, err := sh.Resolve(name)
+	if err != nil {
+		return index, fmt.Errorf("%w %s: %v", errIndexNotResolved, name, err)
+	}
+
+	reader, err := sh.Cat(resolved)
+	if err != nil {
+		return index, fmt.Errorf("could not read backup index %s: %v", resolved, err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if closeErr := reader.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return index, fmt.Errorf("could not read backup index %s: %v", resolved, err)
+	}
+
+	if err = json.Unmarshal(data, &index); err != nil || index.Sources == nil {
+		return index, fmt.Errorf("%s does not point to a backup index", name)
+	}
+	if index.Version > EnvelopeVersion {
+		return index, fmt.Errorf("backup index version %d is not supported, upgrade driver-ipfs", index.Version)
+	}
+	return index, nil
+}
+
+// PublishIndex records a backup as the latest listed under indexName in the index published under
+// the IPNS key named key, signs the index when a signing key is given, and publishes it again.
+// It returns the IPNS name of the index.
+func PublishIndex(sh *shell.Shell, key string, indexName string, entry IndexEntry, signingKey *SigningKey) string {
+
+	name, err := IPNSName(sh, key)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// A name that was never published resolves to nothing, any other failure would lose the other sources.
+	index, err := LoadIndex(sh, name)
+	if errors.Is(err, errIndexNotResolved) {
+		fmt.Fprintln(statusOut, "\nNo backup index published under", name, "yet, starting a new one")
+		index, err = BackupIndex{Sources: map[string]IndexEntry{}}, nil
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	index.Version = EnvelopeVersion
+	index.Updated = time.Now().UTC()
+	index.Sources[indexName] = entry
+	index.Signature = nil
+	if signingKey != nil {
+		index.Signature = signingKey.SignIndex(index.Digest())
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		log.Fatal(err)
+	}
+	hash, err := sh.Add(bytes.NewReader(data))
+	if err != nil {
+		log.Fatal("Could not add backup index to IPFS: ", err)
+	}
+
+	fmt.Fprintln(statusOut, "\nPublishing backup index under", name)
+	if _, err = sh.PublishWithDetails("/ipfs/"+hash, key, 0, 0, false); err != nil {
+		log.Fatal("Could not publish backup index: ", err)
+	}
+	fmt.Fprintf(statusOut, "Published %s as the latest backup of %s\n", entry.Hash, indexName)
+	return name
+}
+
+// ResolveIndexHash returns the shareable hash of the latest backup listed under indexName in the index
+// published under the IPNS name. The index name may be left out when the index has only one.
+// The signature of the index is checked with the policy, like those of backups.
+func ResolveIndexHash(sh *shell.Shell, name string, indexName string, policy TrustPolicy) string {
+
+	fmt.Fprintln(statusOut, "\nResolving backup index", name)
+	index, err := LoadIndex(sh, name)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var problem string
+	switch state, signer := policy.CheckIndex(index.Signature, index.Digest()); state {
+	case SignatureValid:
+		fmt.Fprintln(statusOut, "Index signed by: ", signer)
+	case SignatureUnsigned:
+		problem = "the backup index is not signed"
+	case SignatureUntrusted:
+		problem = fmt.Sprintf("the backup index is signed by %s, which is not a trusted key", signer)
+	case SignatureInvalid:
+		problem = fmt.Sprintf("the signature of the backup index by %s does not match", signer)
+	}
+	if problem != "" && policy.Strict {
+		log.Fatal("Refusing backup index ", name, ": ", problem)
+	}
+	if problem != "" {
+		fmt.Fprintln(statusOut, "Warning:", problem)
+	}
+
+	if indexName == "" {
+		if len(index.Sources) != 1 {
+			sources := make([]string, 0, len(index.Sources))
+			for name := range index.Sources {
+				sources = append(sources, name)
+			}
+			sort.Strings(sources)
+			log.Fatalf("The backup index lists %d sources, select one with --index-name: %s", len(sources), strings.Join(sources, ", "))
+		}
+		for name := range index.Sources {
+			indexName = name
+		}
+	}
+	entry, ok := index.Sources[indexName]
+	if !ok {
+		log.Fatalf("No backup of %q in the backup index", indexName)
+	}
+	fmt.Fprintf(statusOut, "Latest backup of %s: %s of %s\n", indexName, entry.BaseCID, entry.Created.Local().Format("2006-01-02 15:04:05"))
+	return entry.Hash
+}
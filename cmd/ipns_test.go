@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	shell "github.com/ipfs/go-ipfs-api"
+)
+
+// fakeIPFS answers name/resolve and cat like an IPFS node, failing them unless resolves and readable are set.
+func fakeIPFS(resolves bool, readable bool, index string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v0/name/resolve":
+			if !resolves {
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte(`{"Message":"could not resolve name","Code":0,"Type":"error"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"Path":"/ipfs/QmIndex"}`))
+		case "/api/v0/cat":
+			if !readable {
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte(`{"Message":"context deadline exceeded","Code":0,"Type":"error"}`))
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte(index))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestLoadIndex(t *testing.T) {
+	tests := []struct {
+		name        string
+		resolves    bool
+		readable    bool
+		index       string
+		notResolved bool
+		fails       bool
+	}{
+		{name: "published", resolves: true, readable: true, index: `{"version":1,"sources":{"db":{"hash":"QmHash"}}}`},
+		{name: "never published", notResolved: true, fails: true},
+		{name: "unreadable", resolves: true, fails: true},
+		{name: "not an index", resolves: true, readable: true, index: `{"version":1}`, fails: true},
+		{name: "not JSON", resolves: true, readable: true, index: "hello", fails: true},
+		{name: "newer version", resolves: true, readable: true, index: `{"version":99,"sources":{}}`, fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := fakeIPFS(test.resolves, test.readable, test.index)
+			defer server.Close()
+
+			index, err := LoadIndex(shell.NewShell(server.URL), "k51name")
+			if errors.Is(err, errIndexNotResolved) != test.notResolved {
+				t.Fatalf("error %v, want not resolved %v", err, test.notResolved)
+			}
+			if test.fails {
+				if err == nil {
+					t.Fatal("loaded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if index.Sources["db"].Hash != "QmHash" {
+				t.Fatalf("loaded %+v", index)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// keyCmd groups the commands managing keys.
+var keyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Commands to manage encryption keys and identities.",
+	Long:  `Commands to manage the encryption keys and X25519 identities backups are encrypted with.`,
+}
+
+// keyGenerateCmd represents the key generate command.
+var keyGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Command to generate an X25519 identity or an Ed25519 signing key.",
+	Long: `Command to generate an X25519 identity (--type x25519) or an Ed25519 signing key (--type ed25519)
+and print its public key.
+The public key of an identity is added to the recipients of the storj configuration of whoever stores backups,
+the identity is kept secret and configured as identityFile for downloads.
+A signing key is configured as signingKeyFile for store, its public key is added to the trustedKeys for downloads.`,
+	Run: keyGenerate,
+}
+
+// keySplitCmd represents the key split command.
+var keySplitCmd = &cobra.Command{
+	Use:   "split",
+	Short: "Command to split the encryption key into shares.",
+	Long: `Command to split the encryption key of the storj configuration into --shares shares,
+any --threshold of which restore it with key combine or download --key-share.
+Fewer shares reveal nothing about the key. Hand the shares to different people or places.`,
+	Run: keySplit,
+}
+
+// keyCombineCmd represents the key combine command.
+var keyCombineCmd = &cobra.Command{
+	Use:   "combine [share...]",
+	Short: "Command to restore the encryption key from shares.",
+	Long:  `Command to restore the encryption key from enough of the shares created by key split, given as arguments or in --shares-file.`,
+	Run:   keyCombine,
+}
+
+// KeySplitResult is the result of the key split command.
+type KeySplitResult struct {
+	Threshold int      `json:"threshold"`
+	Shares    []string `json:"shares"`
+}
+
+// KeyCombineResult is the result of the key combine command.
+type KeyCombineResult struct {
+	File string `json:"file,omitempty"`
+	Key  string `json:"key,omitempty"`
+}
+
+// Types of keys generated by the key generate command.
+const (
+	KeyTypeX25519  = "x25519"
+	KeyTypeEd25519 = "ed25519"
+)
+
+// KeyResult is the result of the key generate command.
+type KeyResult struct {
+	Type       string `json:"type"`
+	PublicKey  string `json:"publicKey"`
+	File       string `json:"file,omitempty"`
+	PrivateKey string `json:"privateKey,omitempty"`
+}
+
+func init() {
+
+	// Setup the key command and its subcommands with their flags.
+	rootCmd.AddCommand(keyCmd)
+	keyCmd.AddCommand(keyGenerateCmd)
+	keyGenerateCmd.Flags().StringP("type", "t", KeyTypeX25519, "type of key to generate: x25519 (identity) or ed25519 (signing key).")
+	keyGenerateCmd.Flags().StringP("file", "f", "", "file to write the private key to, it is printed on stdout if not given.")
+
+	keyCmd.AddCommand(keySplitCmd)
+	keySplitCmd.Flags().StringP("storj", "u", "././config/storj_config_v01.json", "full filepath contaning storj V3 configuration, its key is split.")
+	keySplitCmd.Flags().IntP("shares", "n", 5, "number of shares to create.")
+	keySplitCmd.Flags().IntP("threshold", "m", 3, "number of shares needed to restore the key.")
+
+	keyCmd.AddCommand(keyCombineCmd)
+	keyCombineCmd.Flags().String("shares-file", "", "file containing shares, one per line.")
+	keyCombineCmd.Flags().StringP("file", "f", "", "file to write the key to, it is printed on stdout if not given.")
+}
+
+func keyGenerate(cmd *cobra.Command, args []string) {
+
+	// Process arguments from the CLI.
+	keyType, _ := cmd.Flags().GetString("type")
+	keyFile, _ := cmd.Flags().GetString("file")
+
+	var privateKey, publicKey string
+	switch keyType {
+	case KeyTypeX25519:
+		identity, err := GenerateIdentity()
+		if err != nil {
+			log.Fatal("Could not generate identity: ", err)
+		}
+		privateKey, publicKey = identity.String(), identity.Recipient().String()
+	case KeyTypeEd25519:
+		signingKey, err := GenerateSigningKey()
+		if err != nil {
+			log.Fatal("Could not generate signing key: ", err)
+		}
+		privateKey, publicKey = signingKey.String(), signingKey.PublicKey()
+	default:
+		log.Fatalf("Unknown key type %q (expected %s or %s)", keyType, KeyTypeX25519, KeyTypeEd25519)
+	}
+	result := KeyResult{Type: keyType, PublicKey: publicKey}
+
+	if keyFile == "" {
+		// In JSON mode the private key is part of the result on stdout.
+		if outputFormat == OutputJSON {
+			result.PrivateKey = privateKey
+		} else {
+			fmt.Println(privateKey)
+		}
+	} else {
+		keyFile = filepath.Clean(keyFile)
+		writeKeyFile(keyFile, fmt.Sprintf("# created: %s\n# public key: %s\n%s\n", time.Now().Format(time.RFC3339), publicKey, privateKey))
+		fmt.Fprintln(statusOut, "Private key written to:", keyFile)
+		result.File = keyFile
+	}
+
+	fmt.Fprintln(statusOut, "Public key:", publicKey)
+	PrintResult(result)
+}
+
+// writeKeyFile creates a file only the user can read holding a key.
+// An existing file is never replaced, backups may depend on the key in it.
+func writeKeyFile(keyFile string, content string) {
+	file, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		log.Fatal("Could not create key file: ", err)
+	}
+	if _, err = file.WriteString(content); err != nil {
+		_ = file.Close()
+		log.Fatal("Could not write key file: ", err)
+	}
+	if err = file.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func keySplit(cmd *cobra.Command, args []string) {
+
+	// Process arguments from the CLI.
+	fullFileNameStorj, _ := cmd.Flags().GetString("storj")
+	shares, _ := cmd.Flags().GetInt("shares")
+	threshold, _ := cmd.Flags().GetInt("threshold")
+
+	// Read the key from the storj configuration or ask for it.
+	storjConfig := LoadStorjConfiguration(fullFileNameStorj)
+	if storjConfig.Key == "" {
+		storjConfig.Key = PromptKey(true)
+	}
+
+	keyShares, err := SplitKey(storjConfig.Key, shares, threshold)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	result := KeySplitResult{Threshold: threshold, Shares: []string{}}
+	fmt.Fprintf(statusOut, "\nSplit the key into %d shares, any %d of them restore it:\n", shares, threshold)
+	for _, share := range keyShares {
+		result.Shares = append(result.Shares, share.String())
+		if outputFormat != OutputJSON {
+			fmt.Println(share.String())
+		}
+	}
+	PrintResult(result)
+}
+
+func keyCombine(cmd *cobra.Command, args []string) {
+
+	// Process arguments from the CLI.
+	sharesFile, _ := cmd.Flags().GetString("shares-file")
+	keyFile, _ := cmd.Flags().GetString("file")
+
+	key := KeyFromShares(args, sharesFile)
+	result := KeyCombineResult{}
+
+	if keyFile == "" {
+		// In JSON mode the key is part of the result on stdout.
+		if outputFormat == OutputJSON {
+			result.Key = key
+		} else {
+			fmt.Println(key)
+		}
+	} else {
+		keyFile = filepath.Clean(keyFile)
+		writeKeyFile(keyFile, key+"\n")
+		fmt.Fprintln(statusOut, "Key written to:", keyFile)
+		result.File = keyFile
+	}
+	PrintResult(result)
+}
+
+// KeyFromShares restores the key from shares given as text and/or in a shares file,
+// one per line. The shares file must not be accessible by group or others.
+func KeyFromShares(texts []string, sharesFile string) string {
+	if sharesFile != "" {
+		data, err := readSecretFile(sharesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		texts = append(texts, keyLines(data)...)
+	}
+	key, err := CombineKeyShareTexts(texts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(statusOut, "Restored key from %d shares\n", len(texts))
+	return key
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Layouts of the object keys of new backups, see ObjectNamer.
+const (
+	KeyLayoutCID  = "cid"
+	KeyLayoutHMAC = "hmac"
+)
+
+// ObjectNamer names the chunks of new backups, which are stored below the ID of their backup.
+// The cid layout names them after their CIDs. The hmac layout names them after HMACs of the CIDs keyed
+// with a key derived from the user's key, so that listing the bucket reveals no CID that could be matched
+// with data on IPFS. The names are recorded in the encrypted manifest, restoring needs no key.
+type ObjectNamer struct {
+	key []byte
+}
+
+// NewObjectNamer returns the namer of the key layout configured for the bucket.
+func NewObjectNamer(configStorj ConfigStorj) (ObjectNamer, error) {
+	switch configStorj.KeyLayout {
+	case "", KeyLayoutCID:
+		return ObjectNamer{}, nil
+	case KeyLayoutHMAC:
+		if configStorj.Key == "" {
+			return ObjectNamer{}, errors.New("the hmac key layout needs the key")
+		}
+		root, err := bucketRootKey(configStorj.Key, configStorj.Bucket)
+		if err != nil {
+			return ObjectNamer{}, err
+		}
+		return ObjectNamer{key: catalogSubkey(root, "layout")}, nil
+	default:
+		return ObjectNamer{}, fmt.Errorf("unknown key layout %q, use %s or %s", configStorj.KeyLayout, KeyLayoutCID, KeyLayoutHMAC)
+	}
+}
+
+// Obfuscated reports whether objects are named after HMACs instead of CIDs.
+func (namer ObjectNamer) Obfuscated() bool {
+	return namer.key != nil
+}
+
+// Name returns the name of the object, or prefix, of cid.
+func (namer ObjectNamer) Name(cid string) string {
+	if namer.key == nil {
+		return cid
+	}
+	mac := hmac.New(sha256.New, namer.key)
+	_, _ = mac.Write([]byte(cid))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import "testing"
+
+func TestObjectNamer(t *testing.T) {
+	const cid = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+
+	tests := []struct {
+		name       string
+		config     ConfigStorj
+		obfuscated bool
+		fails      bool
+	}{
+		{name: "default", config: ConfigStorj{Bucket: "backups", Key: "correct horse"}},
+		{name: "cid", config: ConfigStorj{Bucket: "backups", KeyLayout: KeyLayoutCID}},
+		{name: "hmac", config: ConfigStorj{Bucket: "backups", Key: "correct horse", KeyLayout: KeyLayoutHMAC}, obfuscated: true},
+		{name: "hmac without key", config: ConfigStorj{Bucket: "backups", KeyLayout: KeyLayoutHMAC}, fails: true},
+		{name: "unknown", config: ConfigStorj{Bucket: "backups", Key: "correct horse", KeyLayout: "sha"}, fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			namer, err := NewObjectNamer(test.config)
+			if test.fails {
+				if err == nil {
+					t.Fatal("created a namer, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if namer.Obfuscated() != test.obfuscated {
+				t.Fatalf("obfuscated %v, want %v", namer.Obfuscated(), test.obfuscated)
+			}
+			name := namer.Name(cid)
+			if !test.obfuscated {
+				if name != cid {
+					t.Fatalf("named %q, want the CID", name)
+				}
+				return
+			}
+			if len(name) != 32 || name == cid {
+				t.Fatalf("named %q, want 32 hex digits", name)
+			}
+			again, err := NewObjectNamer(test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again.Name(cid) != name {
+				t.Fatal("the name changed with a new namer")
+			}
+		})
+	}
+}
+
+func TestObjectNamerKeys(t *testing.T) {
+	const cid = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+	seen := map[string]string{}
+	for _, config := range []ConfigStorj{
+		{Bucket: "backups", Key: "correct horse", KeyLayout: KeyLayoutHMAC},
+		{Bucket: "backups", Key: "battery staple", KeyLayout: KeyLayoutHMAC},
+		{Bucket: "archive", Key: "correct horse", KeyLayout: KeyLayoutHMAC},
+	} {
+		namer, err := NewObjectNamer(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := namer.Name(cid)
+		if other, ok := seen[name]; ok {
+			t.Fatalf("bucket %s with key %q names the CID like %s", config.Bucket, config.Key, other)
+		}
+		seen[name] = config.Bucket + " " + config.Key
+		if namer.Name(cid+"x") == name {
+			t.Fatal("two CIDs have the same name")
+		}
+	}
+}
+
+func TestChunkObjectKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		pointer BackupPointer
+		chunk   ManifestChunk
+		want    string
+	}{
+		{name: "cid", pointer: BackupPointer{BaseCID: "QmBase", UploadPath: "ipfs/"}, chunk: ManifestChunk{CID: "QmChunk"}, want: "ipfs/QmBase/QmChunk"},
+		{name: "hmac", pointer: BackupPointer{BaseCID: "QmBase", Name: "0a1b", UploadPath: "ipfs/"}, chunk: ManifestChunk{CID: "QmChunk", Name: "2c3d"}, want: "ipfs/0a1b/2c3d"},
+		{name: "reused", pointer: BackupPointer{BaseCID: "QmBase", Name: "0a1b", UploadPath: "ipfs/"}, chunk: ManifestChunk{CID: "QmChunk", Name: "2c3d", Object: "ipfs/4e5f/2c3d"}, want: "ipfs/4e5f/2c3d"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if key := test.chunk.ObjectKey(test.pointer); key != test.want {
+				t.Fatalf("object key %q, want %q", key, test.want)
+			}
+		})
+	}
+}
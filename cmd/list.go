@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"storj.io/uplink"
+)
+
+// listCmd represents the list command.
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Command to list the backups stored on storj V3 network.",
+	Long:  `Command to list the backups stored under the upload path of the given Storj Bucket.`,
+	Run:   storjList,
+}
+
+func init() {
+
+	// Setup the list command with its flags.
+	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().BoolP("accesskey", "a", false, "Connect to storj using access key(default connection method is by using API Key).")
+	listCmd.Flags().StringP("storj", "u", "././config/storj_config_v01.json", "full filepath contaning storj V3 configuration.")
+}
+
+func storjList(cmd *cobra.Command, args []string) {
+
+	// Process arguments from the CLI.
+	fullFileNameStorj, _ := cmd.Flags().GetString("storj")
+	useAccessKey, _ := cmd.Flags().GetBool("accesskey")
+
+	// Read storj network configurations from and external file and create a storj configuration object.
+	storjConfig := LoadStorjConfiguration(fullFileNameStorj)
+
+	// Connect to storj network using the specified credentials.
+	_, project := ConnectToStorj(fullFileNameStorj, storjConfig, useAccessKey)
+	defer func() {
+		_ = project.Close()
+	}()
+
+	result := ListBackups(project, storjConfig)
+
+	fmt.Fprintf(statusOut, "\n%d backups in %s/%s\n", len(result.Backups), result.Bucket, result.Prefix)
+	for _, backup := range result.Backups {
+		fmt.Fprintf(statusOut, "%s\t%d chunks\t%s\t%s\n", backup.BaseCID, backup.Chunks, formatBytes(backup.Bytes), backup.Created.Format("2006-01-02 15:04:05"))
+	}
+
+	PrintResult(result)
+}
+
+// ListBackups returns the backups stored under the upload path of the configured bucket.
+// Every backup is a prefix named after its ID, or after its base CID for earlier backups, holding the chunks and the manifest.
+func ListBackups(project *uplink.Project, configStorj ConfigStorj) ListResult {
+
+	ctx := context.Background()
+	prefix := configStorj.UploadPath
+	if prefix == "/" {
+		prefix = ""
+	}
+
+	result := ListResult{
+		Bucket:  configStorj.Bucket,
+		Prefix:  prefix,
+		Backups: []BackupEntry{},
+	}
+
+	prefixes := project.ListObjects(ctx, configStorj.Bucket, &uplink.ListObjectsOptions{Prefix: prefix})
+	for prefixes.Next() {
+		item := prefixes.Item()
+		// Backups are named after IDs or CIDs, the catalog and pinsets start with a dot.
+		if !item.IsPrefix || strings.HasPrefix(strings.TrimPrefix(item.Key, prefix), ".") {
+			continue
+		}
+
+		entry := BackupEntry{
+			BaseCID: strings.TrimSuffix(strings.TrimPrefix(item.Key, prefix), "/"),
+			Prefix:  item.Key,
+		}
+
+		// Sum up the chunks of the backup, its meta file is not counted.
+		objects := project.ListObjects(ctx, configStorj.Bucket, &uplink.ListObjectsOptions{Prefix: item.Key, System: true})
+		for objects.Next() {
+			object := objects.Item()
+			if object.IsPrefix {
+				continue
+			}
+			if object.System.Created.After(entry.Created) {
+				entry.Created = object.System.Created
+			}
+			if isMetadataObject(object.Key) {
+				continue
+			}
+			entry.Chunks++
+			entry.Bytes += object.System.ContentLength
+		}
+		if err := objects.Err(); err != nil {
+			log.Fatal("Could not list backup objects: ", err)
+		}
+
+		result.Backups = append(result.Backups, entry)
+	}
+	if err := prefixes.Err(); err != nil {
+		log.Fatal("Could not list backups: ", err)
+	}
+
+	return result
+}
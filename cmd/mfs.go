@@ -0,0 +1,483 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	shell "github.com/ipfs/go-ipfs-api"
+	files "github.com/ipfs/go-ipfs-files"
+	"storj.io/uplink"
+)
+
+// MFSSourcePrefix marks MFS paths among the sources of the catalog, so that they never meet local paths.
+const MFSSourcePrefix = "mfs:"
+
+// Types of the entries of an MFS tree.
+const (
+	MFSFile      = "file"
+	MFSDirectory = "directory"
+)
+
+// MFSTree describes a backup of a directory of the IPFS Mutable File System.
+// The contents of its files are stored one after the other, in the order of the entries,
+// as the data of the backup; directories are listed so that empty ones are restored too.
+type MFSTree struct {
+	Root    string     `json:"root"`
+	RootCID string     `json:"rootCID"`
+	Entries []MFSEntry `json:"entries"`
+}
+
+// MFSEntry is a file or directory of an MFS tree, with its path relative to the root.
+type MFSEntry struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+	CID  string `json:"cid"`
+	Size int64  `json:"size"`
+}
+
+// mfsStat is the part of the files/stat response used here.
+type mfsStat struct {
+	Hash string
+	Size int64
+	Type string
+}
+
+// WalkMFS lists the directory root of MFS, and everything below it, depth first in name order.
+// The tree is listed through the CID of the root at the time of the stat, so later changes to MFS do not mix in.
+func WalkMFS(sh *shell.Shell, root string) (MFSTree, error) {
+
+	root = path.Clean("/" + root)
+
+	var stat mfsStat
+	if err := sh.Request("files/stat", root).Exec(context.Background(), &stat); err != nil {
+		return MFSTree{}, fmt.Errorf("could not stat MFS path %s: %v", root, err)
+	}
+	if stat.Type != MFSDirectory {
+		return MFSTree{}, fmt.Errorf("MFS path %s is not a directory", root)
+	}
+
+	tree := MFSTree{Root: root, RootCID: stat.Hash, Entries: []MFSEntry{}}
+	if err := walkMFSDirectory(sh, stat.Hash, "", &tree); err != nil {
+		return MFSTree{}, err
+	}
+	return tree, nil
+}
+
+func walkMFSDirectory(sh *shell.Shell, rootCID string, dir string, tree *MFSTree) error {
+
+	links, err := sh.List(path.Join("/ipfs", rootCID, dir))
+	if err != nil {
+		return fmt.Errorf("could not list MFS directory %s: %v", path.Join(tree.Root, dir), err)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Name < links[j].Name })
+
+	for _, item := range links {
+		entry := MFSEntry{Path: path.Join(dir, item.Name), CID: item.Hash}
+		if item.Type == shell.TDirectory {
+			entry.Type = MFSDirectory
+			tree.Entries = append(tree.Entries, entry)
+			if err := walkMFSDirectory(sh, rootCID, entry.Path, tree); err != nil {
+				return err
+			}
+			continue
+		}
+		entry.Type = MFSFile
+		entry.Size = int64(item.Size)
+		tree.Entries = append(tree.Entries, entry)
+	}
+	return nil
+}
+
+// Size returns the total size of the files of the tree.
+func (tree MFSTree) Size() int64 {
+	var size int64
+	for _, entry := range tree.Entries {
+		size += entry.Size
+	}
+	return size
+}
+
+// Files returns the number of files of the tree.
+func (tree MFSTree) Files() int {
+	count := 0
+	for _, entry := range tree.Entries {
+		if entry.Type == MFSFile {
+			count++
+		}
+	}
+	return count
+}
+
+// Validate checks that the entries of a restored tree stay below its root.
+func (tree MFSTree) Validate() error {
+	for _, entry := range tree.Entries {
+		if entry.Path == "" || entry.Path != path.Clean(entry.Path) || path.IsAbs(entry.Path) ||
+			entry.Path == ".." || strings.HasPrefix(entry.Path, "../") {
+			return fmt.Errorf("invalid path %q in MFS tree", entry.Path)
+		}
+		if entry.Type != MFSFile && entry.Type != MFSDirectory {
+			return fmt.Errorf("invalid type %q of %q in MFS tree", entry.Type, entry.Path)
+		}
+	}
+	return nil
+}
+
+// MFSName returns the name a backup of the MFS directory root is restored as.
+func MFSName(root string) string {
+	if name := path.Base(path.Clean("/" + root)); name != "/" {
+		return name
+	}
+	return "mfs"
+}
+
+// mfsReader reads the files of a tree one after the other by their recorded CIDs.
+type mfsReader struct {
+	sh        *shell.Shell
+	tree      MFSTree
+	next      int
+	current   io.ReadCloser
+	entry     MFSEntry
+	remaining int64
+}
+
+// OpenMFSReader returns the data of a tree: the contents of its files in order.
+// Files are read with cat by the CIDs recorded in the tree, not by their MFS paths,
+// so the data always matches the manifest. A file of another size than listed fails the read.
+func OpenMFSReader(sh *shell.Shell, tree MFSTree) io.ReadCloser {
+	return &mfsReader{sh: sh, tree: tree}
+}
+
+func (r *mfsReader) Read(p []byte) (int, error) {
+	for r.current == nil {
+		if r.next == len(r.tree.Entries) {
+			return 0, io.EOF
+		}
+		entry := r.tree.Entries[r.next]
+		r.next++
+		if entry.Type != MFSFile || entry.Size == 0 {
+			continue
+		}
+		response, err := r.sh.Request("cat", path.Join("/ipfs", entry.CID)).Send(context.Background())
+		if err != nil {
+			return 0, err
+		}
+		if response.Error != nil {
+			_ = response.Close()
+			return 0, fmt.Errorf("could not read MFS file %s: %v", entry.Path, response.Error)
+		}
+		r.current, r.entry, r.remaining = response.Output, entry, entry.Size
+	}
+
+	n, err := r.current.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n, fmt.Errorf("MFS file %s is longer than listed", r.entry.Path)
+	}
+	if err == io.EOF {
+		_ = r.current.Close()
+		r.current = nil
+		if r.remaining != 0 {
+			return n, fmt.Errorf("MFS file %s is shorter than listed", r.entry.Path)
+		}
+		err = nil
+	}
+	return n, err
+}
+
+func (r *mfsReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
+
+// treeSink receives the directories and files of a restored tree.
+type treeSink interface {
+	Directory(path string) error
+	File(entry MFSEntry) (io.WriteCloser, error)
+}
+
+// treeWriter splits the restored data of a tree into its files.
+type treeWriter struct {
+	sink      treeSink
+	entries   []MFSEntry
+	next      int
+	current   io.WriteCloser
+	entry     MFSEntry
+	remaining int64
+}
+
+// newTreeWriter creates the directories of tree in sink and returns the writer of its files.
+func newTreeWriter(sink treeSink, tree MFSTree) (*treeWriter, error) {
+	if err := sink.Directory(""); err != nil {
+		return nil, err
+	}
+	var fileEntries []MFSEntry
+	for _, entry := range tree.Entries {
+		if entry.Type == MFSDirectory {
+			if err := sink.Directory(entry.Path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		fileEntries = append(fileEntries, entry)
+	}
+	return &treeWriter{sink: sink, entries: fileEntries}, nil
+}
+
+func (w *treeWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if w.current == nil {
+			if err := w.openNext(); err != nil {
+				return written, err
+			}
+			if w.current == nil {
+				return written, errors.New("the restored data is longer than the files of the tree")
+			}
+		}
+		n := len(p)
+		if int64(n) > w.remaining {
+			n = int(w.remaining)
+		}
+		m, err := w.current.Write(p[:n])
+		written += m
+		w.remaining -= int64(m)
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+		if w.remaining == 0 {
+			err = w.current.Close()
+			w.current = nil
+			if err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// openNext opens the next file with content, creating the empty files before it.
+func (w *treeWriter) openNext() error {
+	for w.next < len(w.entries) {
+		entry := w.entries[w.next]
+		w.next++
+		file, err := w.sink.File(entry)
+		if err != nil {
+			return err
+		}
+		if entry.Size == 0 {
+			if err = file.Close(); err != nil {
+				return err
+			}
+			continue
+		}
+		w.current, w.entry, w.remaining = file, entry, entry.Size
+		return nil
+	}
+	return nil
+}
+
+// Finish creates the trailing empty files and checks that every file was restored completely.
+func (w *treeWriter) Finish() error {
+	if w.current != nil {
+		return fmt.Errorf("file %s was not restored completely", w.entry.Path)
+	}
+	if err := w.openNext(); err != nil {
+		return err
+	}
+	if w.current != nil {
+		return fmt.Errorf("file %s was not restored", w.entry.Path)
+	}
+	return nil
+}
+
+// Abort discards the file being written, if it can be.
+func (w *treeWriter) Abort() {
+	if aborter, ok := w.current.(interface{ Abort() }); ok {
+		aborter.Abort()
+	}
+}
+
+// mfsSink rebuilds a tree in MFS below target with files/mkdir and files/write.
+type mfsSink struct {
+	sh     *shell.Shell
+	target string
+}
+
+func (sink mfsSink) Directory(dir string) error {
+	target := path.Join(sink.target, dir)
+	if err := sink.sh.Request("files/mkdir", target).Option("parents", true).Exec(context.Background(), nil); err != nil {
+		return fmt.Errorf("could not create MFS directory %s: %v", target, err)
+	}
+	return nil
+}
+
+func (sink mfsSink) File(entry MFSEntry) (io.WriteCloser, error) {
+	target := path.Join(sink.target, entry.Path)
+	pipeReader, pipeWriter := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		body := files.NewMultiFileReader(files.NewSliceDirectory([]files.DirEntry{files.FileEntry("", files.NewReaderFile(pipeReader))}), true)
+		err := sink.sh.Request("files/write", target).
+			Option("create", true).
+			Option("parents", true).
+			Option("truncate", true).
+			Body(body).
+			Exec(context.Background(), nil)
+		if err != nil {
+			err = fmt.Errorf("could not write MFS file %s: %v", target, err)
+		}
+		_ = pipeReader.CloseWithError(err)
+		done <- err
+	}()
+	return &mfsFileWriter{PipeWriter: pipeWriter, done: done}, nil
+}
+
+// mfsFileWriter streams one file into files/write, Close waits for the write to complete.
+type mfsFileWriter struct {
+	*io.PipeWriter
+	done chan error
+}
+
+func (w *mfsFileWriter) Close() error {
+	_ = w.PipeWriter.Close()
+	return <-w.done
+}
+
+// Stat returns the CID of the rebuilt tree.
+func (sink mfsSink) Stat() (string, error) {
+	var stat mfsStat
+	err := sink.sh.Request("files/stat", sink.target).Exec(context.Background(), &stat)
+	return stat.Hash, err
+}
+
+// directorySink restores a tree into a local directory, applying the overwrite policy to every file.
+type directorySink struct {
+	base   string
+	policy string
+}
+
+func (sink directorySink) Directory(dir string) error {
+	return os.MkdirAll(filepath.Join(sink.base, filepath.FromSlash(dir)), 0750)
+}
+
+func (sink directorySink) File(entry MFSEntry) (io.WriteCloser, error) {
+	writer, destination, err := OpenRestoreWriter(filepath.Join(sink.base, filepath.FromSlash(entry.Path)), "", sink.policy)
+	if err == errSkipDestination {
+		fmt.Fprintf(statusOut, "file \"%s\" already exists, skipping\n", destination)
+		return nopWriteCloser{ioutil.Discard}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return committingFile{writer}, nil
+}
+
+// committingFile moves a restored file into place when it is closed.
+type committingFile struct {
+	RestoreWriter
+}
+
+func (f committingFile) Close() error {
+	return f.Commit()
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// RestoreTree restores the MFS tree of a backup into MFS below downloadConfigStorj.MFSPath,
+// or else into a directory named after the tree in the download path.
+func RestoreTree(project *uplink.Project, downloadConfigStorj DownloadConfigStorj, pointer BackupPointer, manifest Manifest,
+	result DownloadResult, progress ProgressFunc) DownloadResult {
+
+	tree := *manifest.MFS
+	if err := tree.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	result.Files = tree.Files()
+
+	var sink treeSink
+	if downloadConfigStorj.MFSPath != "" {
+		if downloadConfigStorj.IPFS == nil {
+			log.Fatal("Restoring into MFS needs a connection to IPFS")
+		}
+		target := path.Clean("/" + downloadConfigStorj.MFSPath)
+		var stat mfsStat
+		if err := downloadConfigStorj.IPFS.Request("files/stat", target).Exec(context.Background(), &stat); err == nil {
+			switch downloadConfigStorj.Overwrite {
+			case OverwriteOverwrite:
+			case OverwriteSkip:
+				fmt.Fprintf(statusOut, "\n MFS path \"%s\" already exists, skipping download\n", target)
+				result.Destination = MFSSourcePrefix + target
+				result.Skipped = true
+				return result
+			default:
+				log.Fatalf("MFS path %s already exists (use --overwrite overwrite to write into it)", target)
+			}
+		}
+		sink = mfsSink{sh: downloadConfigStorj.IPFS, target: target}
+		result.Destination = MFSSourcePrefix + target
+	} else {
+		if downloadConfigStorj.DownloadPath == StdoutDestination {
+			log.Fatal("Backups of MFS are restored into a directory, or into MFS with --mfs, not to stdout")
+		}
+		base := downloadConfigStorj.DownloadPath
+		if base == "" {
+			base = "."
+		}
+		if info, err := os.Stat(base); (err == nil && info.IsDir()) || strings.HasSuffix(base, "/") || strings.HasSuffix(base, string(os.PathSeparator)) {
+			base = filepath.Join(base, pointer.FileName)
+		}
+		sink = directorySink{base: filepath.Clean(base), policy: downloadConfigStorj.Overwrite}
+		result.Destination = filepath.Clean(base)
+	}
+
+	fmt.Fprintf(statusOut, "Restoring %d files of MFS %s into %s\n", result.Files, tree.Root, result.Destination)
+	writer, err := newTreeWriter(sink, tree)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var tracker *ProgressTracker
+	if progress != nil {
+		tracker = NewProgressTracker("download", StoredSize(project, pointer, manifest), len(manifest.Chunks), progress)
+	}
+	result.Bytes, err = RestoreChunks(project, pointer, manifest.Chunks, writer, tracker)
+	if err == nil {
+		err = writer.Finish()
+	}
+	if err != nil {
+		writer.Abort()
+		log.Fatal(err)
+	}
+	tracker.Finish()
+
+	if mfs, ok := sink.(mfsSink); ok {
+		rootCID, err := mfs.Stat()
+		if err != nil {
+			log.Fatal(err)
+		}
+		result.RootCID = rootCID
+		if rootCID == tree.RootCID {
+			fmt.Fprintln(statusOut, "Restored MFS root matches the backed up root CID", rootCID)
+		} else {
+			fmt.Fprintf(statusOut, "Restored MFS root %s differs from the backed up root %s, the files were probably added with other parameters\n", rootCID, tree.RootCID)
+		}
+	}
+	fmt.Fprintf(statusOut, "\n MFS %s restored to \"%s\"\n", tree.Root, result.Destination)
+	return result
+}
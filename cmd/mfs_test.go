@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestMFSTreeValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry MFSEntry
+		valid bool
+	}{
+		{name: "file", entry: MFSEntry{Path: "photo.jpg", Type: MFSFile}, valid: true},
+		{name: "nested file", entry: MFSEntry{Path: "2020/photo.jpg", Type: MFSFile}, valid: true},
+		{name: "directory", entry: MFSEntry{Path: "2020", Type: MFSDirectory}, valid: true},
+		{name: "dots in name", entry: MFSEntry{Path: "..photo", Type: MFSFile}, valid: true},
+		{name: "empty", entry: MFSEntry{Path: "", Type: MFSFile}},
+		{name: "parent", entry: MFSEntry{Path: "..", Type: MFSDirectory}},
+		{name: "below parent", entry: MFSEntry{Path: "../photo.jpg", Type: MFSFile}},
+		{name: "far below parent", entry: MFSEntry{Path: "../../etc/passwd", Type: MFSFile}},
+		{name: "through parent", entry: MFSEntry{Path: "2020/../../photo.jpg", Type: MFSFile}},
+		{name: "unclean", entry: MFSEntry{Path: "2020/../photo.jpg", Type: MFSFile}},
+		{name: "double slash", entry: MFSEntry{Path: "2020//photo.jpg", Type: MFSFile}},
+		{name: "absolute", entry: MFSEntry{Path: "/etc/passwd", Type: MFSFile}},
+		{name: "other type", entry: MFSEntry{Path: "link", Type: "symlink"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := MFSTree{Root: "/photos", Entries: []MFSEntry{{Path: "a", Type: MFSDirectory}, test.entry}}
+			err := tree.Validate()
+			if test.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !test.valid && err == nil {
+				t.Fatalf("accepted %q", test.entry.Path)
+			}
+		})
+	}
+}
+
+// memorySink collects a restored tree in memory.
+type memorySink struct {
+	directories []string
+	files       map[string]*bytes.Buffer
+}
+
+func (sink *memorySink) Directory(path string) error {
+	sink.directories = append(sink.directories, path)
+	return nil
+}
+
+func (sink *memorySink) File(entry MFSEntry) (io.WriteCloser, error) {
+	buffer := &bytes.Buffer{}
+	sink.files[entry.Path] = buffer
+	return nopWriteCloser{buffer}, nil
+}
+
+func TestTreeWriter(t *testing.T) {
+	tree := MFSTree{Entries: []MFSEntry{
+		{Path: "a", Type: MFSDirectory},
+		{Path: "a/empty", Type: MFSFile},
+		{Path: "a/one", Type: MFSFile, Size: 3},
+		{Path: "b", Type: MFSFile, Size: 5},
+		{Path: "c", Type: MFSFile},
+	}}
+
+	tests := []struct {
+		name  string
+		data  string
+		fails bool
+	}{
+		{name: "complete", data: "onebbbbb"},
+		{name: "short", data: "onebbbb", fails: true},
+		{name: "long", data: "onebbbbbx", fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sink := &memorySink{files: map[string]*bytes.Buffer{}}
+			writer, err := newTreeWriter(sink, tree)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Write one byte at a time, so that every file boundary falls between writes too.
+			for i := 0; i < len(test.data) && err == nil; i++ {
+				_, err = writer.Write([]byte{test.data[i]})
+			}
+			if err == nil {
+				err = writer.Finish()
+			}
+			if test.fails {
+				if err == nil {
+					t.Fatal("restored, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sink.directories) != 2 || sink.directories[0] != "" || sink.directories[1] != "a" {
+				t.Fatalf("created directories %q", sink.directories)
+			}
+			want := map[string]string{"a/empty": "", "a/one": "one", "b": "bbbbb", "c": ""}
+			if len(sink.files) != len(want) {
+				t.Fatalf("created %d files, want %d", len(sink.files), len(want))
+			}
+			for name, data := range want {
+				if file, ok := sink.files[name]; !ok || file.String() != data {
+					t.Fatalf("file %s is %v, want %q", name, file, data)
+				}
+			}
+		})
+	}
+}
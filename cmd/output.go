@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Output formats selected with the global --output flag.
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// outputFormat is the format command results are printed in.
+var outputFormat = OutputText
+
+// StoreResult is the result of the store command.
+type StoreResult struct {
+	BaseCID         string  `json:"baseCID"`
+	PointerHash     string  `json:"pointerHash"`
+	IPNSName        string  `json:"ipnsName,omitempty"`
+	Bucket          string  `json:"bucket"`
+	Prefix          string  `json:"prefix"`
+	FileName        string  `json:"fileName"`
+	Bytes           int64   `json:"bytes"`
+	Chunks          int     `json:"chunks"`
+	Reused          int     `json:"reused,omitempty"`
+	Unchanged       bool    `json:"unchanged,omitempty"`
+	Signer          string  `json:"signer,omitempty"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	SharedAccess    string  `json:"sharedAccess,omitempty"`
+	ShareID         string  `json:"shareID,omitempty"`
+	Ticket          string  `json:"ticket,omitempty"`
+}
+
+// DownloadResult is the result of the download command.
+type DownloadResult struct {
+	BaseCID         string  `json:"baseCID"`
+	Bucket          string  `json:"bucket"`
+	Prefix          string  `json:"prefix"`
+	FileName        string  `json:"fileName"`
+	Destination     string  `json:"destination"`
+	Source          string  `json:"source,omitempty"`
+	Version         int     `json:"version,omitempty"`
+	Files           int     `json:"files,omitempty"`
+	RootCID         string  `json:"rootCID,omitempty"`
+	AddedCID        string  `json:"addedCID,omitempty"`
+	Skipped         bool    `json:"skipped,omitempty"`
+	Bytes           int64   `json:"bytes"`
+	Chunks          int     `json:"chunks"`
+	Signature       string  `json:"signature"`
+	Signer          string  `json:"signer,omitempty"`
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// VerifyResult is the result of the verify command.
+type VerifyResult struct {
+	BaseCID         string  `json:"baseCID"`
+	RestoredCID     string  `json:"restoredCID"`
+	Verified        bool    `json:"verified"`
+	FileName        string  `json:"fileName"`
+	Bytes           int64   `json:"bytes"`
+	Chunks          int     `json:"chunks"`
+	Signature       string  `json:"signature"`
+	Signer          string  `json:"signer,omitempty"`
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// ListResult is the result of the list command.
+type ListResult struct {
+	Bucket  string        `json:"bucket"`
+	Prefix  string        `json:"prefix"`
+	Backups []BackupEntry `json:"backups"`
+}
+
+// BackupEntry describes one backup found in the bucket.
+type BackupEntry struct {
+	BaseCID string    `json:"baseCID"`
+	Prefix  string    `json:"prefix"`
+	Chunks  int       `json:"chunks"`
+	Bytes   int64     `json:"bytes"`
+	Created time.Time `json:"created"`
+}
+
+// errorResult is printed instead of a result when a command fails in JSON mode.
+type errorResult struct {
+	Command string `json:"command"`
+	Error   string `json:"error"`
+}
+
+// setupOutput validates the output format and, for JSON, moves status text to stderr
+// and turns fatal log messages into structured errors on the result output.
+func setupOutput(cmd *cobra.Command, args []string) {
+	switch outputFormat {
+	case OutputText:
+	case OutputJSON:
+		statusOut = os.Stderr
+		log.SetFlags(0)
+		log.SetOutput(&jsonErrorWriter{command: cmd.Name()})
+	default:
+		log.Fatalf("Unknown output format %q (expected %s or %s)", outputFormat, OutputText, OutputJSON)
+	}
+}
+
+// PrintResult prints the result of a command on stdout, or stderr when restoring to stdout,
+// when JSON output is selected.
+// In text mode the result was already reported through the status messages.
+func PrintResult(result interface{}) {
+	if outputFormat != OutputJSON {
+		return
+	}
+	encoder := json.NewEncoder(resultOut)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// jsonErrorWriter writes every log message as a JSON error object to the result output.
+type jsonErrorWriter struct {
+	command string
+}
+
+func (w *jsonErrorWriter) Write(p []byte) (int, error) {
+	data, err := json.Marshal(errorResult{
+		Command: w.command,
+		Error:   string(bytes.TrimSpace(p)),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if _, err = resultOut.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,364 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	shell "github.com/ipfs/go-ipfs-api"
+	"github.com/spf13/cobra"
+	"storj.io/uplink"
+)
+
+// PinSetPrefix is the prefix, under the upload path, of the pinsets stored by pins backup.
+const PinSetPrefix = ".pinsets/"
+
+// pinSetIDLayout names pinsets after the time they were stored, so that they sort in order.
+// A random suffix follows it, see newPinSetID.
+const pinSetIDLayout = "20060102T150405Z"
+
+// pinsCmd represents the pins command.
+var pinsCmd = &cobra.Command{
+	Use:   "pins",
+	Short: "Commands to back up and restore the pins of the IPFS node.",
+}
+
+// pinsBackupCmd represents the pins backup command.
+var pinsBackupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Command to back up every DAG pinned recursively on the IPFS node.",
+	Long: `Command to export every DAG pinned recursively on the IPFS node with dag export and back it up,
+unless it is already recorded in the catalog of sources, and to store the pinset listing all of them.
+The key is required, the catalog and the pinset are encrypted with it.`,
+	Args: cobra.NoArgs,
+	Run:  ipfsPinsBackup,
+}
+
+// pinsRestoreCmd represents the pins restore command.
+var pinsRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Command to re-import and re-pin the DAGs of a pinset on the IPFS node.",
+	Long:  `Command to restore every DAG of the latest pinset, or of the one given with --pinset, with dag import and pin it again.`,
+	Args:  cobra.NoArgs,
+	Run:   ipfsPinsRestore,
+}
+
+// pinsListCmd represents the pins list command.
+var pinsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Command to list the pinsets stored by pins backup.",
+	Args:  cobra.NoArgs,
+	Run:   storjPinsList,
+}
+
+// PinSet is the record of the recursive pins of a node at one time.
+// Every pin refers to the snapshot of the backup of its DAG.
+type PinSet struct {
+	ID      string      `json:"id,omitempty"`
+	Version int         `json:"version"`
+	Created time.Time   `json:"created"`
+	Pins    []PinnedDAG `json:"pins"`
+}
+
+// PinnedDAG is one pin of a pinset.
+type PinnedDAG struct {
+	CID      string   `json:"cid"`
+	Snapshot Snapshot `json:"snapshot"`
+}
+
+// PinsBackupResult is the result of the pins backup command.
+type PinsBackupResult struct {
+	PinSet  string      `json:"pinset"`
+	Stored  int         `json:"stored"`
+	Skipped int         `json:"skipped"`
+	Pins    []PinsEntry `json:"pins"`
+}
+
+// PinsRestoreResult is the result of the pins restore command.
+type PinsRestoreResult struct {
+	PinSet string      `json:"pinset"`
+	Pins   []PinsEntry `json:"pins"`
+}
+
+// PinsEntry describes what happened to one pin.
+type PinsEntry struct {
+	CID     string `json:"cid"`
+	BaseCID string `json:"baseCID,omitempty"`
+	Hash    string `json:"hash,omitempty"`
+	Stored  bool   `json:"stored,omitempty"`
+	Bytes   int64  `json:"bytes,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// PinsListResult is the result of the pins list command.
+type PinsListResult struct {
+	PinSets []PinSetEntry `json:"pinsets"`
+}
+
+// PinSetEntry describes one stored pinset.
+type PinSetEntry struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Pins    int       `json:"pins"`
+}
+
+func init() {
+
+	// Setup the pins commands with their flags.
+	rootCmd.AddCommand(pinsCmd)
+	for _, command := range []*cobra.Command{pinsBackupCmd, pinsRestoreCmd, pinsListCmd} {
+		pinsCmd.AddCommand(command)
+		command.Flags().BoolP("accesskey", "a", false, "Connect to storj using access key(default connection method is by using API Key).")
+		command.Flags().StringP("storj", "u", "././config/storj_config_v01.json", "full filepath contaning storj V3 configuration.")
+	}
+	pinsBackupCmd.Flags().StringP("ipfs", "i", "././config/ipfs_property_v01.json", "full filepath contaning IPFS configuration.")
+	pinsRestoreCmd.Flags().StringP("ipfs", "i", "././config/ipfs_property_v01.json", "full filepath contaning IPFS configuration.")
+	pinsRestoreCmd.Flags().String("pinset", "", "id of the pinset to restore, see pins list (default the latest).")
+}
+
+// connectPins loads the configurations of the pins commands and connects to Storj and the catalog.
+// confirm asks for the key twice when it has to be typed in.
+func connectPins(cmd *cobra.Command, confirm bool) (ConfigStorj, *uplink.Project, *Catalog) {
+
+	fullFileNameStorj, _ := cmd.Flags().GetString("storj")
+	useAccessKey, _ := cmd.Flags().GetBool("accesskey")
+
+	// Read storj network configurations from and external file and create a storj configuration object.
+	storjConfig := LoadStorjConfiguration(fullFileNameStorj)
+	if storjConfig.Key == "" {
+		storjConfig.Key = PromptKey(confirm)
+	}
+
+	// Connect to storj network using the specified credentials.
+	_, project := ConnectToStorj(fullFileNameStorj, storjConfig, useAccessKey)
+	defer func() {
+		_ = project.Close()
+	}()
+
+	catalog, err := OpenCatalog(project, storjConfig, storjConfig.Key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return storjConfig, project, catalog
+}
+
+func ipfsPinsBackup(cmd *cobra.Command, args []string) {
+
+	ipfsConfigfilePath, _ := cmd.Flags().GetString("ipfs")
+
+	// Read IPFS instance's configurations from an external file and create an IPFS configuration object.
+	configIpfs := LoadIpfsProperty(ipfsConfigfilePath)
+
+	storjConfig, project, catalog := connectPins(cmd, true)
+	recipients, signingKey := StoreKeys(storjConfig)
+
+	// Connect to IPFS using the specified credentials
+	ipfsShell := ConnectToIpfs(configIpfs)
+
+	pins, err := ipfsShell.Pins()
+	if err != nil {
+		log.Fatal("Could not list pins: ", err)
+	}
+	var roots []string
+	for cid, info := range pins {
+		if info.Type == shell.RecursivePin {
+			roots = append(roots, cid)
+		}
+	}
+	sort.Strings(roots)
+	fmt.Fprintf(statusOut, "\n%d recursive pins on the node\n", len(roots))
+
+	chunkSize, _ := strconv.ParseInt(configIpfs.ChunkSize, 0, 64)
+	namer, err := NewObjectNamer(storjConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pinSet := PinSet{Version: EnvelopeVersion, Created: time.Now().UTC()}
+	result := PinsBackupResult{Pins: []PinsEntry{}}
+	for _, root := range roots {
+		history, err := catalog.Load(DAGSourcePrefix + root)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// DAGs never change, one backup of each is enough.
+		snapshot := history.Latest()
+		stored := snapshot == nil
+		if !stored {
+			fmt.Fprintf(statusOut, "%s already backed up as %s\n", root, snapshot.BaseCID)
+			result.Skipped++
+		} else {
+			fmt.Fprintf(statusOut, "\nBacking up DAG %s\n", root)
+			backup := StoreDAG(project, ipfsShell, storjConfig, root, StoreOptions{ChunkSize: chunkSize, Add: configIpfs.AddParams(), Namer: namer, Progress: progressPrinter(cmd)}, recipients, signingKey)
+			history.Record(backup)
+			catalog.Save(history)
+			snapshot = &backup
+			result.Stored++
+		}
+
+		pinSet.Pins = append(pinSet.Pins, PinnedDAG{CID: root, Snapshot: *snapshot})
+		result.Pins = append(result.Pins, PinsEntry{CID: root, BaseCID: snapshot.BaseCID, Hash: snapshot.Hash, Stored: stored})
+	}
+
+	result.PinSet = catalog.SavePinSet(pinSet)
+	fmt.Fprintf(statusOut, "\nPinset %s stored: %d pins, %d backed up now, %d already in the bucket\n", result.PinSet, len(roots), result.Stored, result.Skipped)
+	PrintResult(result)
+}
+
+func ipfsPinsRestore(cmd *cobra.Command, args []string) {
+
+	ipfsConfigfilePath, _ := cmd.Flags().GetString("ipfs")
+	pinSetID, _ := cmd.Flags().GetString("pinset")
+
+	// Read IPFS instance's configurations from an external file and create an IPFS configuration object.
+	configIpfs := LoadIpfsProperty(ipfsConfigfilePath)
+
+	storjConfig, project, catalog := connectPins(cmd, false)
+
+	// Connect to IPFS using the specified credentials
+	ipfsShell := ConnectToIpfs(configIpfs)
+
+	if pinSetID == "" {
+		ids, err := catalog.PinSetIDs()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(ids) == 0 {
+			log.Fatal("No pinsets stored, back them up with pins backup")
+		}
+		pinSetID = ids[len(ids)-1]
+	}
+	pinSet, err := catalog.LoadPinSet(pinSetID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(statusOut, "\nRestoring %d pins of pinset %s\n", len(pinSet.Pins), pinSetID)
+
+	result := PinsRestoreResult{PinSet: pinSetID, Pins: []PinsEntry{}}
+	failed := 0
+	for _, pin := range pinSet.Pins {
+		entry := PinsEntry{CID: pin.CID, BaseCID: pin.Snapshot.BaseCID, Hash: pin.Snapshot.Hash}
+		entry.Bytes, err = RestoreDAG(project, ipfsShell, pin.Snapshot.Pointer(storjConfig.Bucket), pin.CID, progressPrinter(cmd))
+		if err == nil {
+			// Importing pins the root already, pinning again makes sure the pin is recursive.
+			err = ipfsShell.Pin(pin.CID)
+		}
+		if err != nil {
+			failed++
+			entry.Error = err.Error()
+			fmt.Fprintf(statusOut, "Could not restore %s: %v\n", pin.CID, err)
+		} else {
+			fmt.Fprintf(statusOut, "Restored and pinned %s\n", pin.CID)
+		}
+		result.Pins = append(result.Pins, entry)
+	}
+
+	PrintResult(result)
+	if failed > 0 {
+		log.Fatalf("%d of %d pins could not be restored", failed, len(pinSet.Pins))
+	}
+}
+
+func storjPinsList(cmd *cobra.Command, args []string) {
+
+	_, _, catalog := connectPins(cmd, false)
+
+	ids, err := catalog.PinSetIDs()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	result := PinsListResult{PinSets: []PinSetEntry{}}
+	fmt.Fprintf(statusOut, "\n%d pinsets\n", len(ids))
+	for _, id := range ids {
+		pinSet, err := catalog.LoadPinSet(id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(statusOut, "%s\t%s\t%d pins\n", id, pinSet.Created.Local().Format("2006-01-02 15:04:05"), len(pinSet.Pins))
+		result.PinSets = append(result.PinSets, PinSetEntry{ID: id, Created: pinSet.Created, Pins: len(pinSet.Pins)})
+	}
+	PrintResult(result)
+}
+
+// newPinSetID names a pinset created at the given time.
+// The random suffix keeps pinsets stored in the same second from overwriting each other.
+func newPinSetID(created time.Time) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := io.ReadFull(rand.Reader, suffix); err != nil {
+		return "", err
+	}
+	return created.UTC().Format(pinSetIDLayout) + "-" + hex.EncodeToString(suffix), nil
+}
+
+// SavePinSet stores a pinset sealed like the catalog and returns its id.
+// A new pinset gets a new id, one that was loaded is stored again under its own.
+func (catalog *Catalog) SavePinSet(pinSet PinSet) string {
+	if pinSet.ID == "" {
+		id, err := newPinSetID(pinSet.Created)
+		if err != nil {
+			log.Fatal("Could not name pinset: ", err)
+		}
+		pinSet.ID = id
+	}
+	sealed, err := sealJSON(catalog.sealKey, pinSet)
+	if err != nil {
+		log.Fatal("Could not encrypt pinset: ", err)
+	}
+	uploadObject(catalog.project, ConfigStorj{Bucket: catalog.bucket, UploadPath: catalog.uploadPath},
+		PinSetPrefix+pinSet.ID, bytes.NewReader(sealed))
+	return pinSet.ID
+}
+
+// PinSetIDs lists the ids of the stored pinsets, oldest first.
+func (catalog *Catalog) PinSetIDs() ([]string, error) {
+	prefix := catalog.uploadPath + PinSetPrefix
+	var ids []string
+	objects := catalog.project.ListObjects(context.Background(), catalog.bucket, &uplink.ListObjectsOptions{Prefix: prefix})
+	for objects.Next() {
+		if !objects.Item().IsPrefix {
+			ids = append(ids, strings.TrimPrefix(objects.Item().Key, prefix))
+		}
+	}
+	if err := objects.Err(); err != nil {
+		return nil, fmt.Errorf("could not list pinsets: %v", err)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// LoadPinSet reads and decrypts the pinset with the given id.
+func (catalog *Catalog) LoadPinSet(id string) (PinSet, error) {
+
+	var pinSet PinSet
+
+	download, err := catalog.project.DownloadObject(context.Background(), catalog.bucket, catalog.uploadPath+PinSetPrefix+id, nil)
+	if errors.Is(err, uplink.ErrObjectNotFound) {
+		return pinSet, fmt.Errorf("no pinset %q, see pins list", id)
+	}
+	if err != nil {
+		return pinSet, fmt.Errorf("could not open pinset: %v", err)
+	}
+	sealed, err := ioutil.ReadAll(download)
+	if closeErr := download.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return pinSet, fmt.Errorf("could not read pinset: %v", err)
+	}
+
+	if err = openJSON(catalog.sealKey, sealed, &pinSet); err != nil {
+		return pinSet, fmt.Errorf("could not decrypt pinset %s, was it written with another key? %v", id, err)
+	}
+	return pinSet, nil
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNewPinSetID(t *testing.T) {
+	created := time.Date(2026, 10, 19, 8, 15, 0, 0, time.UTC)
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		id, err := newPinSetID(created)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(id) != len("20261019T081500Z-00000000") || id[:17] != "20261019T081500Z-" || seen[id] {
+			t.Fatalf("pinset id %q is not the time and a random suffix", id)
+		}
+		seen[id] = true
+	}
+
+	// Pinsets sort by time.
+	later, err := newPinSetID(created.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	earlier, err := newPinSetID(created.Add(-time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now, err := newPinSetID(created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{later, now, earlier}
+	sort.Strings(ids)
+	if ids[0] != earlier || ids[1] != now || ids[2] != later {
+		t.Fatalf("pinsets sort as %q", ids)
+	}
+}
@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Progress describes how far a transfer has come.
+// Totals are zero when they are not known up front, e.g. when reading from stdin.
+type Progress struct {
+	Operation   string
+	BytesDone   int64
+	BytesTotal  int64
+	ChunksDone  int
+	ChunksTotal int
+	Elapsed     time.Duration
+	// Throughput is the current transfer rate in bytes per second.
+	Throughput float64
+	// ETA is the estimated remaining time, zero when it can not be estimated.
+	ETA  time.Duration
+	Done bool
+}
+
+// ProgressFunc is called whenever a transfer made progress.
+type ProgressFunc func(Progress)
+
+// progressSampleInterval is the minimum time between two throughput samples.
+const progressSampleInterval = 500 * time.Millisecond
+
+// ProgressTracker accounts transferred bytes and chunks and reports them to a ProgressFunc.
+// A nil *ProgressTracker ignores all calls, so callers need no checks.
+type ProgressTracker struct {
+	mu       sync.Mutex
+	progress Progress
+	callback ProgressFunc
+	now      func() time.Time
+
+	start       time.Time
+	lastSample  time.Time
+	lastSampled int64
+}
+
+// NewProgressTracker starts tracking an operation. It returns nil when callback is nil.
+func NewProgressTracker(operation string, bytesTotal int64, chunksTotal int, callback ProgressFunc) *ProgressTracker {
+	return newProgressTracker(operation, bytesTotal, chunksTotal, callback, time.Now)
+}
+
+// newProgressTracker starts tracking an operation with the given clock.
+func newProgressTracker(operation string, bytesTotal int64, chunksTotal int, callback ProgressFunc, now func() time.Time) *ProgressTracker {
+	if callback == nil {
+		return nil
+	}
+	start := now()
+	return &ProgressTracker{
+		progress: Progress{
+			Operation:   operation,
+			BytesTotal:  bytesTotal,
+			ChunksTotal: chunksTotal,
+		},
+		callback:   callback,
+		now:        now,
+		start:      start,
+		lastSample: start,
+	}
+}
+
+// AddBytes records n transferred bytes.
+func (t *ProgressTracker) AddBytes(n int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.progress.BytesDone += n
+	t.report(false)
+	t.mu.Unlock()
+}
+
+// ChunkDone records a completed chunk.
+func (t *ProgressTracker) ChunkDone() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.progress.ChunksDone++
+	t.report(true)
+	t.mu.Unlock()
+}
+
+// Finish reports the final state of the operation.
+func (t *ProgressTracker) Finish() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.progress.Done = true
+	t.report(true)
+	t.mu.Unlock()
+}
+
+// Reader wraps reader so that everything read from it is recorded.
+func (t *ProgressTracker) Reader(reader io.Reader) io.Reader {
+	if t == nil {
+		return reader
+	}
+	return &progressReader{reader: reader, tracker: t}
+}
+
+// report updates the throughput sample and calls the callback.
+// Byte updates are only reported once per sample interval unless forced.
+func (t *ProgressTracker) report(force bool) {
+	now := t.now()
+	sinceSample := now.Sub(t.lastSample)
+	if !force && sinceSample < progressSampleInterval {
+		return
+	}
+
+	if sinceSample >= progressSampleInterval {
+		rate := float64(t.progress.BytesDone-t.lastSampled) / sinceSample.Seconds()
+		if t.progress.Throughput == 0 {
+			t.progress.Throughput = rate
+		} else {
+			// Smooth the rate so the ETA does not jump around.
+			t.progress.Throughput = 0.7*t.progress.Throughput + 0.3*rate
+		}
+		t.lastSample = now
+		t.lastSampled = t.progress.BytesDone
+	}
+
+	t.progress.Elapsed = now.Sub(t.start)
+	t.progress.ETA = 0
+	if t.progress.BytesTotal > 0 && t.progress.Throughput > 0 && !t.progress.Done {
+		remaining := t.progress.BytesTotal - t.progress.BytesDone
+		if remaining > 0 {
+			t.progress.ETA = time.Duration(float64(remaining) / t.progress.Throughput * float64(time.Second))
+		}
+	}
+	if t.progress.Done && t.progress.Elapsed > 0 {
+		t.progress.Throughput = float64(t.progress.BytesDone) / t.progress.Elapsed.Seconds()
+	}
+
+	t.callback(t.progress)
+}
+
+// progressReader records the bytes read through it.
+type progressReader struct {
+	reader  io.Reader
+	tracker *ProgressTracker
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.tracker.AddBytes(int64(n))
+	}
+	return n, err
+}
+
+// progressLogInterval is the time between two progress lines when not writing to a terminal.
+const progressLogInterval = 10 * time.Second
+
+// NewProgressPrinter returns a ProgressFunc printing to w.
+// On a terminal a live progress bar is drawn, otherwise a line is logged periodically.
+func NewProgressPrinter(w io.Writer) ProgressFunc {
+	return newProgressPrinter(w, isTerminal(w), time.Now)
+}
+
+// newProgressPrinter returns a ProgressFunc drawing a bar on a terminal and logging lines by the given clock otherwise.
+func newProgressPrinter(w io.Writer, terminal bool, now func() time.Time) ProgressFunc {
+	if terminal {
+		return func(p Progress) {
+			fmt.Fprintf(w, "\r\033[K%s", formatProgressBar(p))
+			if p.Done {
+				fmt.Fprintln(w)
+			}
+		}
+	}
+
+	var lastLog time.Time
+	return func(p Progress) {
+		if !p.Done && now().Sub(lastLog) < progressLogInterval {
+			return
+		}
+		lastLog = now()
+		fmt.Fprintln(w, formatProgressLine(p))
+	}
+}
+
+// isTerminal reports whether w is a character device such as a terminal.
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// formatProgressBar renders p as a single terminal line with a bar.
+func formatProgressBar(p Progress) string {
+	const width = 30
+	bar := strings.Repeat(" ", width)
+	if p.BytesTotal > 0 {
+		filled := int(float64(width) * float64(p.BytesDone) / float64(p.BytesTotal))
+		if filled > width {
+			filled = width
+		}
+		bar = strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+	}
+	return fmt.Sprintf("%s [%s] %s", p.Operation, bar, formatProgressDetails(p))
+}
+
+// formatProgressLine renders p as a plain log line.
+func formatProgressLine(p Progress) string {
+	return p.Operation + ": " + formatProgressDetails(p)
+}
+
+// formatProgressDetails renders the amounts, rate and ETA of p.
+func formatProgressDetails(p Progress) string {
+	var b strings.Builder
+	if p.BytesTotal > 0 {
+		fmt.Fprintf(&b, "%s/%s (%d%%)", formatBytes(p.BytesDone), formatBytes(p.BytesTotal), p.BytesDone*100/p.BytesTotal)
+	} else {
+		b.WriteString(formatBytes(p.BytesDone))
+	}
+	if p.ChunksTotal > 0 {
+		fmt.Fprintf(&b, ", %d/%d chunks", p.ChunksDone, p.ChunksTotal)
+	} else {
+		fmt.Fprintf(&b, ", %d chunks", p.ChunksDone)
+	}
+	fmt.Fprintf(&b, ", %s/s", formatBytes(int64(p.Throughput)))
+	if p.Done {
+		fmt.Fprintf(&b, ", done in %s", p.Elapsed.Round(time.Second))
+	} else if p.ETA > 0 {
+		fmt.Fprintf(&b, ", ETA %s", p.ETA.Round(time.Second))
+	}
+	return b.String()
+}
+
+// formatBytes renders n bytes with a binary unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
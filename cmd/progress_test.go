@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock tests advance by hand.
+type fakeClock struct {
+	now time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	return clock.now
+}
+
+func (clock *fakeClock) Advance(d time.Duration) {
+	clock.now = clock.now.Add(d)
+}
+
+func TestProgressTracker(t *testing.T) {
+	type step struct {
+		advance time.Duration
+		bytes   int64
+		chunk   bool
+		finish  bool
+	}
+	tests := []struct {
+		name    string
+		total   int64
+		steps   []step
+		reports int
+		want    Progress
+	}{
+		{
+			name:    "rate and eta",
+			total:   1000,
+			steps:   []step{{advance: time.Second, bytes: 100}},
+			reports: 1,
+			want:    Progress{BytesDone: 100, BytesTotal: 1000, Elapsed: time.Second, Throughput: 100, ETA: 9 * time.Second},
+		},
+		{
+			name:    "bytes within the sample interval",
+			total:   1000,
+			steps:   []step{{advance: time.Second, bytes: 100}, {advance: 100 * time.Millisecond, bytes: 100}},
+			reports: 1,
+			want:    Progress{BytesDone: 100, BytesTotal: 1000, Elapsed: time.Second, Throughput: 100, ETA: 9 * time.Second},
+		},
+		{
+			name:    "smoothed rate",
+			total:   1000,
+			steps:   []step{{advance: time.Second, bytes: 100}, {advance: time.Second, bytes: 200}},
+			reports: 2,
+			want: Progress{BytesDone: 300, BytesTotal: 1000, Elapsed: 2 * time.Second, Throughput: 130,
+				ETA: 5384615384 * time.Nanosecond},
+		},
+		{
+			name:    "chunk within the sample interval",
+			total:   1000,
+			steps:   []step{{advance: time.Second, bytes: 100}, {advance: 100 * time.Millisecond, chunk: true}},
+			reports: 2,
+			want: Progress{BytesDone: 100, BytesTotal: 1000, ChunksDone: 1, Elapsed: 1100 * time.Millisecond,
+				Throughput: 100, ETA: 9 * time.Second},
+		},
+		{
+			name:    "unknown total",
+			steps:   []step{{advance: time.Second, bytes: 100}},
+			reports: 1,
+			want:    Progress{BytesDone: 100, Elapsed: time.Second, Throughput: 100},
+		},
+		{
+			name:    "finished",
+			total:   1000,
+			steps:   []step{{advance: time.Second, bytes: 100}, {advance: time.Second, finish: true}},
+			reports: 2,
+			want:    Progress{BytesDone: 100, BytesTotal: 1000, Elapsed: 2 * time.Second, Throughput: 50, Done: true},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+			var reports []Progress
+			tracker := newProgressTracker("store", test.total, 0, func(p Progress) {
+				reports = append(reports, p)
+			}, clock.Now)
+
+			for _, step := range test.steps {
+				clock.Advance(step.advance)
+				switch {
+				case step.finish:
+					tracker.Finish()
+				case step.chunk:
+					tracker.ChunkDone()
+				default:
+					tracker.AddBytes(step.bytes)
+				}
+			}
+
+			if len(reports) != test.reports {
+				t.Fatalf("reported %d times, want %d", len(reports), test.reports)
+			}
+			got := reports[len(reports)-1]
+			test.want.Operation = "store"
+			if math.Abs(got.Throughput-test.want.Throughput) > 1e-9 || math.Abs(float64(got.ETA-test.want.ETA)) > float64(time.Millisecond) {
+				t.Fatalf("throughput %f and ETA %s, want %f and %s", got.Throughput, got.ETA, test.want.Throughput, test.want.ETA)
+			}
+			got.Throughput, got.ETA = test.want.Throughput, test.want.ETA
+			if got != test.want {
+				t.Fatalf("reported %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestProgressTrackerCallback(t *testing.T) {
+	if tracker := NewProgressTracker("store", 10, 1, nil); tracker != nil {
+		t.Fatal("tracking without a callback")
+	}
+
+	// A nil tracker ignores all calls and passes readers through.
+	var tracker *ProgressTracker
+	tracker.AddBytes(1)
+	tracker.ChunkDone()
+	tracker.Finish()
+	reader := strings.NewReader("data")
+	if tracker.Reader(reader) != reader {
+		t.Fatal("nil tracker wrapped the reader")
+	}
+
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	var last Progress
+	tracker = newProgressTracker("download", 4, 1, func(p Progress) { last = p }, clock.Now)
+	clock.Advance(time.Second)
+	data, err := ioutil.ReadAll(tracker.Reader(strings.NewReader("data")))
+	if err != nil || string(data) != "data" {
+		t.Fatalf("read %q, %v", data, err)
+	}
+	tracker.ChunkDone()
+	tracker.Finish()
+	if want := (Progress{Operation: "download", BytesDone: 4, BytesTotal: 4, ChunksDone: 1, ChunksTotal: 1,
+		Elapsed: time.Second, Throughput: 4, Done: true}); last != want {
+		t.Fatalf("reported %+v, want %+v", last, want)
+	}
+}
+
+func TestProgressPrinter(t *testing.T) {
+	progress := Progress{Operation: "store", BytesDone: 512, BytesTotal: 1024, ChunksDone: 1, ChunksTotal: 2, Throughput: 256, ETA: 2 * time.Second}
+	done := Progress{Operation: "store", BytesDone: 1024, BytesTotal: 1024, ChunksDone: 2, ChunksTotal: 2, Throughput: 512, Elapsed: 2 * time.Second, Done: true}
+
+	tests := []struct {
+		name     string
+		terminal bool
+		advances []time.Duration
+		want     string
+	}{
+		{
+			name:     "terminal",
+			terminal: true,
+			advances: []time.Duration{0, time.Second, 0},
+			want: "\r\033[Kstore [===============               ] 512 B/1.0 KiB (50%), 1/2 chunks, 256 B/s, ETA 2s" +
+				"\r\033[Kstore [===============               ] 512 B/1.0 KiB (50%), 1/2 chunks, 256 B/s, ETA 2s" +
+				"\r\033[Kstore [==============================] 1.0 KiB/1.0 KiB (100%), 2/2 chunks, 512 B/s, done in 2s\n",
+		},
+		{
+			name:     "periodic lines",
+			advances: []time.Duration{0, time.Second, 10 * time.Second, 0},
+			want: "store: 512 B/1.0 KiB (50%), 1/2 chunks, 256 B/s, ETA 2s\n" +
+				"store: 512 B/1.0 KiB (50%), 1/2 chunks, 256 B/s, ETA 2s\n" +
+				"store: 1.0 KiB/1.0 KiB (100%), 2/2 chunks, 512 B/s, done in 2s\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+			var output bytes.Buffer
+			printer := newProgressPrinter(&output, test.terminal, clock.Now)
+			for i, advance := range test.advances {
+				clock.Advance(advance)
+				if i == len(test.advances)-1 {
+					printer(done)
+				} else {
+					printer(progress)
+				}
+			}
+			if output.String() != test.want {
+				t.Fatalf("printed %q, want %q", output.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestFormatProgressDetails(t *testing.T) {
+	tests := []struct {
+		progress Progress
+		want     string
+	}{
+		{progress: Progress{BytesDone: 1536, ChunksDone: 3}, want: "1.5 KiB, 3 chunks, 0 B/s"},
+		{progress: Progress{BytesDone: 0, BytesTotal: 3 << 20, ChunksTotal: 12, Throughput: 1 << 20}, want: "0 B/3.0 MiB (0%), 0/12 chunks, 1.0 MiB/s"},
+		{progress: Progress{BytesDone: 5 << 30, BytesTotal: 10 << 30, Throughput: 100 << 20, ETA: 51*time.Second + 200*time.Millisecond},
+			want: "5.0 GiB/10.0 GiB (50%), 0 chunks, 100.0 MiB/s, ETA 51s"},
+		{progress: Progress{BytesDone: 1023, Elapsed: 90 * time.Second, Done: true, ETA: time.Second}, want: "1023 B, 0 chunks, 0 B/s, done in 1m30s"},
+	}
+	for _, test := range tests {
+		if got := formatProgressDetails(test.progress); got != test.want {
+			t.Errorf("%+v: got %q, want %q", test.progress, got, test.want)
+		}
+	}
+}
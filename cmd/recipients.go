@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	shell "github.com/ipfs/go-ipfs-api"
+	"github.com/spf13/cobra"
+	"storj.io/uplink"
+)
+
+// recipientsCmd groups the commands managing the recipients of backups.
+var recipientsCmd = &cobra.Command{
+	Use:   "recipients",
+	Short: "Commands to manage the recipients of existing backups.",
+	Long:  `Commands to manage the X25519 recipients the data keys of existing backups are encrypted to.`,
+}
+
+// recipientsAddCmd represents the recipients add command.
+var recipientsAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Command to encrypt existing backups to more recipients.",
+	Long: `Command to encrypt the data key of one backup (--hash) or of all backups in the bucket (--all)
+to additional recipients, republish their envelopes to IPFS and print the new shareable hashes.
+The data key is unwrapped with the configured key or an identity. Chunks are never downloaded or re-uploaded.`,
+	Run: ipfsAddRecipients,
+}
+
+func init() {
+
+	// Setup the recipients command and its subcommands with their flags.
+	rootCmd.AddCommand(recipientsCmd)
+	recipientsCmd.AddCommand(recipientsAddCmd)
+	recipientsAddCmd.Flags().StringP("ipfs", "i", "././config/ipfs_property_v01.json", "full filepath contaning IPFS configuration.")
+	recipientsAddCmd.Flags().BoolP("accesskey", "a", false, "Connect to storj using access key(default connection method is by using API Key).")
+	recipientsAddCmd.Flags().StringP("storj", "u", "././config/storj_config_v01.json", "full filepath contaning storj V3 configuration.")
+	recipientsAddCmd.Flags().String("hash", "", "shareable hash of the backup to add recipients to.")
+	recipientsAddCmd.Flags().Bool("all", false, "add the recipients to all backups stored under the upload path of the bucket.")
+	recipientsAddCmd.Flags().StringSliceP("recipient", "r", nil, "public key of a recipient to add, may be repeated.")
+	recipientsAddCmd.Flags().String("identity-file", "", "file containing an identity the backups are already encrypted to.")
+}
+
+func ipfsAddRecipients(cmd *cobra.Command, args []string) {
+
+	// Process arguments from the CLI.
+	ipfsConfigfilePath, _ := cmd.Flags().GetString("ipfs")
+	fullFileNameStorj, _ := cmd.Flags().GetString("storj")
+	useAccessKey, _ := cmd.Flags().GetBool("accesskey")
+	hash, _ := cmd.Flags().GetString("hash")
+	addAll, _ := cmd.Flags().GetBool("all")
+	recipientTexts, _ := cmd.Flags().GetStringSlice("recipient")
+	identityFile, _ := cmd.Flags().GetString("identity-file")
+
+	if hash == "" && !addAll {
+		log.Fatal("Specify the backup to add recipients to with --hash or use --all")
+	}
+	recipients, err := ParseRecipients(recipientTexts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(recipients) == 0 {
+		log.Fatal("Specify the recipients to add with --recipient")
+	}
+
+	// Read storj network configurations from and external file and create a storj configuration object.
+	storjConfig := LoadStorjConfiguration(fullFileNameStorj)
+
+	credentials := Credentials{
+		Key:        storjConfig.Key,
+		Identities: LoadIdentities(SecretSource{Name: "identity", Env: EnvIdentity, File: identityFile}),
+	}
+	if credentials.Empty() {
+		credentials.Key = PromptKey(false)
+	}
+
+	// Read IPFS instance's configurations from an external file and create an IPFS configuration object.
+	configIpfs := LoadIpfsProperty(ipfsConfigfilePath)
+
+	// Connect to storj network using the specified credentials.
+	_, project := ConnectToStorj(fullFileNameStorj, storjConfig, useAccessKey)
+	defer func() {
+		_ = project.Close()
+	}()
+
+	// Connect to IPFS using the specified credentials
+	ipfsShell := ConnectToIpfs(configIpfs)
+
+	result := RepublishBackups(project, ipfsShell, storjConfig, hash, addAll,
+		func(envelope Envelope) RekeyEntry {
+			return AddRecipients(project, ipfsShell, envelope, credentials, recipients)
+		},
+		func(data []byte) RekeyEntry {
+			return RekeyEntry{Error: "backups stored before envelopes can not have recipients, store them again"}
+		})
+
+	// The catalog of sources records the hashes as well, it can only be opened with the key.
+	newHashes := map[string]string{}
+	for _, entry := range result.Backups {
+		if entry.Error == "" && entry.OldHash != "" {
+			newHashes[entry.OldHash] = entry.NewHash
+		}
+	}
+	switch {
+	case len(newHashes) == 0:
+	case credentials.Key == "":
+		fmt.Fprintln(statusOut, "Not updating the hashes recorded in the catalog of sources, that needs the key")
+	default:
+		catalog, err := OpenCatalog(project, storjConfig, credentials.Key)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sources, err := catalog.UpdateHashes(newHashes)
+		if err != nil {
+			log.Fatal("Could not update the catalog of sources: ", err)
+		}
+		if sources > 0 {
+			fmt.Fprintf(statusOut, "Updated the hashes of %d sources in the catalog\n", sources)
+		}
+	}
+
+	failed := 0
+	for _, entry := range result.Backups {
+		if entry.Error != "" {
+			failed++
+			fmt.Fprintf(statusOut, "Could not add recipients to %s: %s\n", entry.BaseCID, entry.Error)
+			continue
+		}
+		fmt.Fprintf(statusOut, "Added %d recipients to %s, Shareable Hash: %s\n", len(recipients), entry.BaseCID, entry.NewHash)
+	}
+
+	PrintResult(result)
+	if failed > 0 {
+		log.Fatalf("%d of %d backups could not be updated", failed, len(result.Backups))
+	}
+}
+
+// AddRecipients encrypts the data key of a backup to more recipients and republishes its envelope.
+// The previous envelope of a private backup is kept and still opens for whoever it was made for.
+func AddRecipients(project *uplink.Project, ipfsShell *shell.Shell, envelope Envelope, credentials Credentials, recipients []Recipient) RekeyEntry {
+
+	return rewriteEnvelope(project, ipfsShell, envelope, credentials, false,
+		func(envelope *Envelope, pointer BackupPointer) error {
+			stanzas, err := WrapForRecipients(recipients, pointer.DataKey)
+			if err != nil {
+				return err
+			}
+			envelope.Recipients = append(envelope.Recipients, stanzas...)
+			return nil
+		})
+}
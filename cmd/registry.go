@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"storj.io/uplink"
+)
+
+// EnvShareRegistry overrides the location of the share registry.
+const EnvShareRegistry = "DRIVER_IPFS_SHARE_REGISTRY"
+
+// ShareRegistry is the local record of the accesses shared by this user, so that they can be revoked.
+// It holds the serialized accesses themselves and is only readable by the user.
+type ShareRegistry struct {
+	Shares []ShareRecord `json:"shares"`
+}
+
+// ShareRecord describes one shared access.
+type ShareRecord struct {
+	ID          string     `json:"id"`
+	BaseCID     string     `json:"baseCID"`
+	Bucket      string     `json:"bucket"`
+	Prefix      string     `json:"prefix"`
+	Permissions string     `json:"permissions"`
+	NotBefore   time.Time  `json:"notBefore"`
+	NotAfter    time.Time  `json:"notAfter"`
+	Created     time.Time  `json:"created"`
+	Revoked     *time.Time `json:"revoked,omitempty"`
+	Access      string     `json:"access,omitempty"`
+}
+
+// Status returns whether the share is revoked, expired, pending or active at now.
+func (record ShareRecord) Status(now time.Time) string {
+	switch {
+	case record.Revoked != nil:
+		return "revoked"
+	case !record.NotAfter.IsZero() && !now.Before(record.NotAfter):
+		return "expired"
+	case !record.NotBefore.IsZero() && now.Before(record.NotBefore):
+		return "pending"
+	default:
+		return "active"
+	}
+}
+
+// ShareFingerprint identifies a serialized access without revealing it.
+func ShareFingerprint(serializedAccess string) string {
+	digest := sha256.Sum256([]byte(serializedAccess))
+	return hex.EncodeToString(digest[:6])
+}
+
+// ShareRegistryPath returns the location of the share registry: the path from the environment,
+// or shares.json in the driver-ipfs directory of the user's configuration directory.
+func ShareRegistryPath() (string, error) {
+	if path := os.Getenv(EnvShareRegistry); path != "" {
+		return filepath.Clean(path), nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "driver-ipfs", "shares.json"), nil
+}
+
+// LoadShareRegistry reads the share registry, a missing registry is empty.
+func LoadShareRegistry(path string) (ShareRegistry, error) {
+	var registry ShareRegistry
+	data, err := ioutil.ReadFile(filepath.Clean(path))
+	if os.IsNotExist(err) {
+		return registry, nil
+	}
+	if err != nil {
+		return registry, err
+	}
+	if err = json.Unmarshal(data, &registry); err != nil {
+		return registry, fmt.Errorf("invalid share registry %s: %v", path, err)
+	}
+	return registry, nil
+}
+
+// Save replaces the share registry at path, readable by the user only.
+func (registry ShareRegistry) Save(path string) error {
+	data, err := json.MarshalIndent(registry, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(path), ".shares.json.tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err = temp.Write(data); err != nil {
+		_ = temp.Close()
+		_ = os.Remove(temp.Name())
+		return err
+	}
+	if err = temp.Close(); err != nil {
+		_ = os.Remove(temp.Name())
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// Find returns the index of the share whose ID starts with id, which must be unambiguous.
+func (registry ShareRegistry) Find(id string) (int, error) {
+	found := -1
+	for i, record := range registry.Shares {
+		if !strings.HasPrefix(record.ID, id) {
+			continue
+		}
+		if found >= 0 {
+			return -1, fmt.Errorf("share id %q is ambiguous", id)
+		}
+		found = i
+	}
+	if found < 0 {
+		return -1, fmt.Errorf("no share with id %q in the registry", id)
+	}
+	return found, nil
+}
+
+// RecordShare adds a shared access to the registry and returns its ID.
+// Failures are reported but do not fail the command, the access was already created.
+func RecordShare(pointer BackupPointer, permission uplink.Permission, serializedAccess string) string {
+
+	record := ShareRecord{
+		ID:          ShareFingerprint(serializedAccess),
+		BaseCID:     pointer.BaseCID,
+		Bucket:      pointer.Bucket,
+		Prefix:      pointer.Prefix(),
+		Permissions: describePermission(permission),
+		NotBefore:   permission.NotBefore,
+		NotAfter:    permission.NotAfter,
+		Created:     time.Now(),
+		Access:      serializedAccess,
+	}
+
+	path, err := ShareRegistryPath()
+	if err == nil {
+		var registry ShareRegistry
+		if registry, err = LoadShareRegistry(path); err == nil {
+			registry.Shares = append(registry.Shares, record)
+			err = registry.Save(path)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(statusOut, "Warning: could not record the share, it can only be revoked with the access itself:", err)
+		return record.ID
+	}
+	fmt.Fprintf(statusOut, "Share %s recorded in %s\n", record.ID, path)
+	return record.ID
+}
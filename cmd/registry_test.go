@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"storj.io/uplink"
+)
+
+func TestShareRecordStatus(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	revoked := now.Add(-time.Hour)
+	tests := []struct {
+		name   string
+		record ShareRecord
+		want   string
+	}{
+		{name: "unlimited", record: ShareRecord{}, want: "active"},
+		{name: "within window", record: ShareRecord{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)}, want: "active"},
+		{name: "not yet valid", record: ShareRecord{NotBefore: now.Add(time.Minute)}, want: "pending"},
+		{name: "valid from now", record: ShareRecord{NotBefore: now}, want: "active"},
+		{name: "expired", record: ShareRecord{NotAfter: now.Add(-time.Minute)}, want: "expired"},
+		{name: "expiring now", record: ShareRecord{NotAfter: now}, want: "expired"},
+		{name: "revoked", record: ShareRecord{NotAfter: now.Add(-time.Minute), Revoked: &revoked}, want: "revoked"},
+	}
+	for _, test := range tests {
+		if got := test.record.Status(now); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestShareRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "driver-ipfs", "shares.json")
+	if err = os.Setenv(EnvShareRegistry, path); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Unsetenv(EnvShareRegistry) }()
+
+	registry, err := LoadShareRegistry(path)
+	if err != nil || len(registry.Shares) != 0 {
+		t.Fatalf("missing registry has %d shares, %v", len(registry.Shares), err)
+	}
+
+	// Record two shares of the same backup.
+	defer func(out io.Writer) { statusOut = out }(statusOut)
+	statusOut = ioutil.Discard
+	pointer := BackupPointer{Version: 1, BaseCID: "QmBase", Name: "0123abcd", ID: "0123abcd", Bucket: "backups", UploadPath: "ipfs/"}
+	notAfter := time.Now().Add(time.Hour).Truncate(time.Second)
+	first := RecordShare(pointer, uplink.Permission{AllowDownload: true, NotAfter: notAfter}, "first access")
+	second := RecordShare(pointer, uplink.Permission{AllowDownload: true, AllowList: true}, "second access")
+	if first != ShareFingerprint("first access") || second != ShareFingerprint("second access") || first == second {
+		t.Fatalf("recorded shares %s and %s", first, second)
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Fatalf("registry has mode %v, want 0600", info.Mode().Perm())
+		}
+	}
+
+	registry, err = LoadShareRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(registry.Shares) != 2 {
+		t.Fatalf("registry lists %d shares, want 2", len(registry.Shares))
+	}
+	record := registry.Shares[0]
+	if record.ID != first || record.BaseCID != "QmBase" || record.Bucket != "backups" || record.Prefix != "ipfs/0123abcd/" ||
+		record.Permissions != "download" || !record.NotAfter.Equal(notAfter) || record.Access != "first access" || record.Revoked != nil {
+		t.Fatalf("recorded %+v", record)
+	}
+	if registry.Shares[1].Permissions != "download, list" || registry.Shares[1].Status(time.Now()) != "active" {
+		t.Fatalf("recorded %+v", registry.Shares[1])
+	}
+
+	// Revoking marks the share and keeps it listed.
+	index, err := registry.Find(second[:6])
+	if err != nil || index != 1 {
+		t.Fatalf("found share %d, %v", index, err)
+	}
+	revoked := time.Now().Truncate(time.Second)
+	registry.Shares[index].Revoked = &revoked
+	if err = registry.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	registry, err = LoadShareRegistry(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(registry.Shares) != 2 || registry.Shares[0].Revoked != nil || registry.Shares[1].Status(time.Now()) != "revoked" {
+		t.Fatalf("after revoking: %+v", registry.Shares)
+	}
+
+	// Saving replaces the registry without leaving temporary files behind.
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("registry directory holds %d files", len(files))
+	}
+}
+
+func TestShareRegistryFind(t *testing.T) {
+	registry := ShareRegistry{Shares: []ShareRecord{{ID: "abc123"}, {ID: "abd456"}, {ID: "ff0000"}}}
+	tests := []struct {
+		id    string
+		want  int
+		fails bool
+	}{
+		{id: "abc123", want: 0},
+		{id: "abd", want: 1},
+		{id: "f", want: 2},
+		{id: "ab", fails: true},
+		{id: "", fails: true},
+		{id: "123", fails: true},
+	}
+	for _, test := range tests {
+		index, err := registry.Find(test.id)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%q: found share %d", test.id, index)
+			}
+			continue
+		}
+		if err != nil || index != test.want {
+			t.Errorf("%q: found share %d, %v, want %d", test.id, index, err, test.want)
+		}
+	}
+}
+
+func TestLoadShareRegistryRejectsGarbage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "shares.json")
+	if err = ioutil.WriteFile(path, []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadShareRegistry(path); err == nil {
+		t.Fatal("loaded a garbled registry")
+	}
+}
@@ -0,0 +1,292 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	shell "github.com/ipfs/go-ipfs-api"
+	"github.com/spf13/cobra"
+	"storj.io/uplink"
+)
+
+// rekeyCmd represents the rekey command.
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Command to change the encryption key of existing backups.",
+	Long: `Command to rewrap the data key of one backup (--hash) or of all backups in the bucket (--all)
+under a new encryption key, republish their envelopes to IPFS and print the new shareable hashes.
+With --all the catalog of sources of incremental backups is moved to the new key as well.
+Backups recorded in the catalog can only be rekeyed with --all: the catalog holds their data keys
+under the current key, which would still restore them.
+Chunks are never downloaded or re-uploaded.`,
+	Run: ipfsRekey,
+}
+
+// RekeyResult is the result of the rekey command.
+type RekeyResult struct {
+	Backups []RekeyEntry `json:"backups"`
+}
+
+// RekeyEntry describes one backup whose envelope was republished.
+type RekeyEntry struct {
+	BaseCID string `json:"baseCID"`
+	OldHash string `json:"oldHash,omitempty"`
+	NewHash string `json:"newHash,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func init() {
+
+	// Setup the rekey command with its flags.
+	rootCmd.AddCommand(rekeyCmd)
+	rekeyCmd.Flags().StringP("ipfs", "i", "././config/ipfs_property_v01.json", "full filepath contaning IPFS configuration.")
+	rekeyCmd.Flags().BoolP("accesskey", "a", false, "Connect to storj using access key(default connection method is by using API Key).")
+	rekeyCmd.Flags().StringP("storj", "u", "././config/storj_config_v01.json", "full filepath contaning storj V3 configuration, its key is the current key.")
+	rekeyCmd.Flags().String("hash", "", "shareable hash of the backup to rekey.")
+	rekeyCmd.Flags().Bool("all", false, "rekey all backups stored under the upload path of the bucket.")
+	rekeyCmd.Flags().String("new-key-file", "", "file containing the new encryption key.")
+	rekeyCmd.Flags().String("new-key-command", "", "command printing the new encryption key.")
+}
+
+func ipfsRekey(cmd *cobra.Command, args []string) {
+
+	// Process arguments from the CLI.
+	ipfsConfigfilePath, _ := cmd.Flags().GetString("ipfs")
+	fullFileNameStorj, _ := cmd.Flags().GetString("storj")
+	useAccessKey, _ := cmd.Flags().GetBool("accesskey")
+	hash, _ := cmd.Flags().GetString("hash")
+	rekeyAll, _ := cmd.Flags().GetBool("all")
+	newKeyFile, _ := cmd.Flags().GetString("new-key-file")
+	newKeyCommand, _ := cmd.Flags().GetString("new-key-command")
+
+	if hash == "" && !rekeyAll {
+		log.Fatal("Specify the backup to rekey with --hash or use --all")
+	}
+
+	// Read storj network configurations from and external file and create a storj configuration object.
+	storjConfig := LoadStorjConfiguration(fullFileNameStorj)
+
+	// The configured key is the current one, the new one comes from its own sources.
+	oldKey := storjConfig.Key
+	if oldKey == "" {
+		oldKey = promptRekeySecret("Current encryption key", false)
+	}
+	newKey := loadSecret(SecretSource{Name: "new key", Env: EnvNewKey, File: newKeyFile, Command: newKeyCommand})
+	if newKey == "" {
+		newKey = promptRekeySecret("New encryption key", true)
+	}
+	if newKey == oldKey {
+		log.Fatal("The new encryption key is the same as the current one")
+	}
+
+	// Read IPFS instance's configurations from an external file and create an IPFS configuration object.
+	configIpfs := LoadIpfsProperty(ipfsConfigfilePath)
+
+	// Connect to storj network using the specified credentials.
+	_, project := ConnectToStorj(fullFileNameStorj, storjConfig, useAccessKey)
+	defer func() {
+		_ = project.Close()
+	}()
+
+	// Connect to IPFS using the specified credentials
+	ipfsShell := ConnectToIpfs(configIpfs)
+
+	// The catalog is sealed under one key for all sources and keeps the data key of every snapshot.
+	// Rekeying a single backup it records would leave that backup open to the current key.
+	if !rekeyAll {
+		catalog, err := OpenCatalog(project, storjConfig, oldKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		recorded, err := catalog.Records(hash)
+		if err != nil {
+			log.Fatal("Could not read the catalog of sources: ", err)
+		}
+		if recorded {
+			log.Fatal("The backup is recorded in the catalog of sources, which keeps its data key under the current key: rekey all backups with --all")
+		}
+	}
+
+	result := RepublishBackups(project, ipfsShell, storjConfig, hash, rekeyAll,
+		func(envelope Envelope) RekeyEntry {
+			return RekeyEnvelope(project, ipfsShell, envelope, oldKey, newKey)
+		},
+		func(data []byte) RekeyEntry {
+			return rekeyLegacyPointer(ipfsShell, data, oldKey, newKey)
+		})
+
+	// The catalog of sources is encrypted with the key as well, it follows when all backups are rekeyed.
+	if rekeyAll {
+		newHashes := map[string]string{}
+		for _, entry := range result.Backups {
+			if entry.Error == "" {
+				newHashes[entry.OldHash] = entry.NewHash
+			}
+		}
+		sources, err := RekeyCatalog(project, storjConfig, oldKey, newKey, newHashes)
+		if err != nil {
+			log.Fatal("Could not rekey the catalog of sources: ", err)
+		}
+		if sources > 0 {
+			fmt.Fprintf(statusOut, "Rekeyed the catalog of %d sources\n", sources)
+		}
+	}
+
+	failed := 0
+	for _, entry := range result.Backups {
+		if entry.Error != "" {
+			failed++
+			fmt.Fprintf(statusOut, "Could not rekey %s: %s\n", entry.BaseCID, entry.Error)
+			continue
+		}
+		fmt.Fprintf(statusOut, "Rekeyed %s, Shareable Hash: %s\n", entry.BaseCID, entry.NewHash)
+	}
+
+	PrintResult(result)
+	if failed > 0 {
+		log.Fatalf("%d of %d backups could not be rekeyed", failed, len(result.Backups))
+	}
+}
+
+// RepublishBackups applies update to the envelope of the backup behind hash and, with all set,
+// to the envelopes stored next to every backup under the upload path of the bucket.
+// Pointers of legacy backups can only be given by hash and are passed to updateLegacy.
+// The old hash is unpinned once its backup has been republished.
+func RepublishBackups(project *uplink.Project, ipfsShell *shell.Shell, storjConfig ConfigStorj, hash string, all bool,
+	update func(Envelope) RekeyEntry, updateLegacy func([]byte) RekeyEntry) RekeyResult {
+
+	result := RekeyResult{Backups: []RekeyEntry{}}
+
+	// The envelope behind hash is replaced first and must not be updated again with all.
+	var updated string
+	if hash != "" {
+		data, err := ioutil.ReadAll(ReadPointerRecord(project, storjConfig, ipfsShell, hash))
+		if err != nil {
+			log.Fatal("IPFS data read error: ", err)
+		}
+		var entry RekeyEntry
+		if len(data) > 0 && data[0] == '{' {
+			envelope := ParseEnvelope(data)
+			updated = envelope.StoredObject()
+			entry = update(envelope)
+		} else {
+			entry = updateLegacy(data)
+		}
+		entry.OldHash = hash
+		if entry.Error == "" {
+			// Stop providing the previous envelope from this node.
+			_ = ipfsShell.Unpin(hash)
+		}
+		result.Backups = append(result.Backups, entry)
+	}
+
+	if all {
+		for _, backup := range ListBackups(project, storjConfig).Backups {
+			envelopes := ReadStoredEnvelopes(project, storjConfig.Bucket, backup.Prefix)
+			if len(envelopes) == 0 {
+				fmt.Fprintf(statusOut, "Skipping %s: no envelope stored, update legacy backups with --hash\n", backup.BaseCID)
+				continue
+			}
+			for _, envelope := range envelopes {
+				if envelope.StoredObject() == updated {
+					continue
+				}
+				oldHash := EnvelopeHash(ipfsShell, envelope)
+				entry := update(envelope)
+				entry.OldHash = oldHash
+				result.Backups = append(result.Backups, entry)
+			}
+		}
+	}
+
+	return result
+}
+
+// promptRekeySecret asks for one of the keys of the rekey command.
+func promptRekeySecret(prompt string, confirm bool) string {
+	secret, err := PromptSecret(prompt, confirm)
+	if err == errNoTerminal {
+		log.Fatalf("No terminal to ask for the %s: configure the current key in the storj configuration and the new one with %s, --new-key-file or --new-key-command", prompt, EnvNewKey)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return secret
+}
+
+// RekeyEnvelope rewraps the data key of a backup from oldKey to newKey and republishes its envelope.
+func RekeyEnvelope(project *uplink.Project, ipfsShell *shell.Shell, envelope Envelope, oldKey string, newKey string) RekeyEntry {
+
+	if envelope.WrappedKey == nil {
+		return RekeyEntry{BaseCID: envelope.BaseCID, Error: "the backup is only encrypted to recipients and has no key to change"}
+	}
+
+	// The old key must not open private backups through their old hash any more.
+	return rewriteEnvelope(project, ipfsShell, envelope, Credentials{Key: oldKey}, true,
+		func(envelope *Envelope, pointer BackupPointer) error {
+			wrapped, err := WrapKey(newKey, pointer.DataKey)
+			if err != nil {
+				return err
+			}
+			envelope.WrappedKey = &wrapped
+			return nil
+		})
+}
+
+// rewriteEnvelope opens the envelope of a backup with credentials and lets change update it, then
+// replaces the copy of the envelope in the bucket and publishes it to IPFS, unless the backup is private.
+// With revoke, the envelope a private backup was stored under before is deleted.
+// Failures are reported in the returned entry, so that other backups can continue.
+func rewriteEnvelope(project *uplink.Project, ipfsShell *shell.Shell, envelope Envelope, credentials Credentials, revoke bool,
+	change func(*Envelope, BackupPointer) error) RekeyEntry {
+
+	entry := RekeyEntry{BaseCID: envelope.BaseCID}
+
+	pointer, err := envelope.Open(credentials)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+
+	var oldHash string
+	if revoke && envelope.Private {
+		oldHash = EnvelopeHash(ipfsShell, envelope)
+	}
+	if err = change(&envelope, pointer); err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+
+	// Replace the copy in the bucket the backup is stored in.
+	location := ConfigStorj{Bucket: pointer.Bucket, UploadPath: pointer.UploadPath}
+	entry.NewHash = SaveEnvelope(project, ipfsShell, location, envelope)
+
+	if oldHash != "" {
+		if err = DeletePrivateEnvelope(project, location, oldHash); err != nil {
+			entry.Error = fmt.Sprintf("could not delete the previous envelope: %v", err)
+		}
+	}
+	return entry
+}
+
+// rekeyLegacyPointer re-encrypts the pointer of a backup in the legacy format with newKey
+// and adds it to IPFS. The chunks of legacy backups do not depend on the key.
+func rekeyLegacyPointer(ipfsShell *shell.Shell, data []byte, oldKey string, newKey string) RekeyEntry {
+
+	pointer := readLegacyPointer(data, oldKey)
+	entry := RekeyEntry{BaseCID: pointer.BaseCID}
+
+	newData, err := writeLegacyPointer(pointer, newKey)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+
+	entry.NewHash, err = ipfsShell.Add(bytes.NewReader(newData))
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return entry
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -12,6 +13,22 @@ var rootCmd = &cobra.Command{
 	Use:   "driver-IPFS",
 	Short: "Back-up IPFS data to the decentralized Storj network.",
 	Long:  `driver-IPFS - Back-up your IPFS data to the decentralized Storj network.`,
+
+	PersistentPreRun: setupOutput,
+}
+
+// statusOut receives the status messages printed while a command runs.
+// It is switched to stderr when stdout carries the restored data itself.
+var statusOut io.Writer = os.Stdout
+
+// resultOut receives the JSON result, and errors, of a command.
+// It is switched to stderr as well when stdout carries the restored data.
+var resultOut io.Writer = os.Stdout
+
+// streamToStdout keeps stdout free for restored data by moving everything else to stderr.
+func streamToStdout() {
+	statusOut = os.Stderr
+	resultOut = os.Stderr
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -19,10 +36,24 @@ var rootCmd = &cobra.Command{
 func Execute() {
 
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		if outputFormat == OutputJSON {
+			PrintResult(errorResult{Error: err.Error()})
+		} else {
+			fmt.Println(err)
+		}
 		os.Exit(1)
 	}
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVar(&outputFormat, "output", OutputText, "output format of the command result: text or json.")
+	rootCmd.PersistentFlags().Bool("progress", true, "report transfer progress (bar on a terminal, periodic lines otherwise).")
+}
+
+// progressPrinter returns the progress callback for a command, or nil when progress is disabled.
+func progressPrinter(cmd *cobra.Command) ProgressFunc {
+	if enabled, _ := cmd.Flags().GetBool("progress"); !enabled {
+		return nil
+	}
+	return NewProgressPrinter(statusOut)
 }
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Environment variables that take precedence over the secrets of the configuration files.
+const (
+	EnvKey                  = "DRIVER_IPFS_KEY"
+	EnvAPIKey               = "DRIVER_IPFS_APIKEY"
+	EnvSerializedAccess     = "DRIVER_IPFS_SERIALIZED_ACCESS"
+	EnvEncryptionPassphrase = "DRIVER_IPFS_ENCRYPTION_PASSPHRASE"
+	EnvSigningKey           = "DRIVER_IPFS_SIGNING_KEY"
+
+	// EnvNewKey supplies the new key of the rekey command.
+	EnvNewKey = "DRIVER_IPFS_NEW_KEY"
+
+	// EnvIdentity supplies the X25519 identities restores are decrypted with.
+	EnvIdentity = "DRIVER_IPFS_IDENTITY"
+)
+
+// SecretSource describes where a secret may be read from, in order of precedence:
+// an environment variable, a secret file, the stdout of a command, or the inline configuration value.
+type SecretSource struct {
+	Name    string
+	Env     string
+	File    string
+	Command string
+	Inline  string
+}
+
+// Configured reports whether any source of the secret is set.
+func (source SecretSource) Configured() bool {
+	return os.Getenv(source.Env) != "" || source.File != "" || source.Command != "" || source.Inline != ""
+}
+
+// Resolve returns the secret and a description of where it was read from.
+// It returns an empty secret and origin when no source is configured.
+func (source SecretSource) Resolve() (string, string, error) {
+	if source.Env != "" {
+		if value := os.Getenv(source.Env); value != "" {
+			return value, "environment " + source.Env, nil
+		}
+	}
+	if source.File != "" {
+		value, err := readSecretFile(source.File)
+		if err != nil {
+			return "", "", fmt.Errorf("%s: %v", source.Name, err)
+		}
+		return value, "file " + source.File, nil
+	}
+	if source.Command != "" {
+		value, err := runSecretCommand(source.Command)
+		if err != nil {
+			return "", "", fmt.Errorf("%s: %v", source.Name, err)
+		}
+		return value, "command", nil
+	}
+	if source.Inline != "" {
+		return source.Inline, "configuration", nil
+	}
+	return "", "", nil
+}
+
+// readSecretFile reads a secret from a file that must not be accessible by group or others.
+func readSecretFile(fileName string) (string, error) {
+	fileName = filepath.Clean(fileName)
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return "", err
+	}
+	// Windows does not report unix permission bits.
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("secret file %q is accessible by other users (mode %v), restrict it with chmod 600", fileName, info.Mode().Perm())
+	}
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// runSecretCommand runs command through the shell and returns its stdout.
+// The command shares stdin and stderr with the driver, so it may prompt the user.
+func runSecretCommand(command string) (string, error) {
+	var secretCmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		secretCmd = exec.Command("cmd", "/C", command)
+	} else {
+		secretCmd = exec.Command("sh", "-c", command)
+	}
+	var stdout bytes.Buffer
+	secretCmd.Stdin = os.Stdin
+	secretCmd.Stdout = &stdout
+	secretCmd.Stderr = os.Stderr
+	if err := secretCmd.Run(); err != nil {
+		return "", fmt.Errorf("secret command failed: %v", err)
+	}
+	secret := strings.TrimRight(stdout.String(), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("secret command printed nothing")
+	}
+	return secret, nil
+}
+
+// MaskSecret hides all but the last characters of a secret so it can be displayed.
+func MaskSecret(secret string) string {
+	if secret == "" {
+		return "(not set)"
+	}
+	if len(secret) <= 16 {
+		return "********"
+	}
+	return "********" + secret[len(secret)-4:]
+}
+
+// errNoTerminal is returned by PromptSecret when there is no terminal to ask on.
+var errNoTerminal = errors.New("no terminal available to prompt for the secret")
+
+// PromptSecret reads a secret from the terminal without echoing it.
+// With confirm set the secret has to be entered twice.
+// The terminal is used even when stdin carries data, e.g. for store --input -.
+func PromptSecret(prompt string, confirm bool) (string, error) {
+	tty, closeTTY, err := openTerminal()
+	if err != nil {
+		return "", err
+	}
+	defer closeTTY()
+
+	fmt.Fprint(os.Stderr, prompt+": ")
+	secret, err := terminal.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if len(secret) == 0 {
+		return "", errors.New("empty secret entered")
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "Confirm "+strings.ToLower(prompt[:1])+prompt[1:]+": ")
+		again, err := terminal.ReadPassword(int(tty.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if !bytes.Equal(secret, again) {
+			return "", errors.New("the entered secrets do not match")
+		}
+	}
+	return string(secret), nil
+}
+
+// openTerminal returns the controlling terminal, preferring stdin.
+func openTerminal() (*os.File, func(), error) {
+	if terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return os.Stdin, func() {}, nil
+	}
+	if runtime.GOOS == "windows" {
+		return nil, nil, errNoTerminal
+	}
+	tty, err := os.Open("/dev/tty")
+	if err != nil || !terminal.IsTerminal(int(tty.Fd())) {
+		if tty != nil {
+			_ = tty.Close()
+		}
+		return nil, nil, errNoTerminal
+	}
+	return tty, func() { _ = tty.Close() }, nil
+}
+
+// LoadIdentities resolves and parses the identities of source.
+// It returns no identities when no source is configured.
+func LoadIdentities(source SecretSource) []*Identity {
+	text := loadSecret(source)
+	if text == "" {
+		return nil
+	}
+	identities, err := ParseIdentities(text)
+	if err != nil {
+		log.Fatalf("%s: %v", source.Name, err)
+	}
+	return identities
+}
+
+// PromptKey asks for the encryption key when no source of it is configured.
+// It refuses to continue when there is no terminal to ask on.
+func PromptKey(confirm bool) string {
+	key, err := PromptSecret("Encryption key", confirm)
+	if err == errNoTerminal {
+		log.Fatalf("No encryption key configured: set key, keyFile or keyCommand in the configuration or %s, or run interactively", EnvKey)
+	}
+	if err != nil {
+		log.Fatal("Could not read the encryption key: ", err)
+	}
+	return key
+}
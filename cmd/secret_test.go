@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestMaskSecret(t *testing.T) {
+	tests := []struct {
+		secret string
+		want   string
+	}{
+		{secret: "", want: "(not set)"},
+		{secret: "short", want: "********"},
+		{secret: "exactly 16 chars", want: "********"},
+		{secret: "seventeen chars!!", want: "********rs!!"},
+		{secret: "1dfJ9Nmb2vVVPqTKkD4DQLyBWTyjcc1rSkXZyQpKRRRd", want: "********RRRd"},
+	}
+	for _, test := range tests {
+		if got := MaskSecret(test.secret); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.secret, got, test.want)
+		}
+	}
+}
+
+func TestReadSecretFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows does not report unix permission bits")
+	}
+	dir, err := ioutil.TempDir("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	tests := []struct {
+		name    string
+		mode    os.FileMode
+		content string
+		want    string
+		fails   bool
+	}{
+		{name: "owner only", mode: 0600, content: "key\n", want: "key"},
+		{name: "read only", mode: 0400, content: "key", want: "key"},
+		{name: "crlf", mode: 0600, content: "key\r\n", want: "key"},
+		{name: "inner whitespace kept", mode: 0600, content: " key with spaces \n", want: " key with spaces "},
+		{name: "group readable", mode: 0640, content: "key\n", fails: true},
+		{name: "world readable", mode: 0644, content: "key\n", fails: true},
+		{name: "group writable", mode: 0620, content: "key\n", fails: true},
+		{name: "others only", mode: 0604, content: "key\n", fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fileName := filepath.Join(dir, strings.Replace(test.name, " ", "-", -1))
+			if err := ioutil.WriteFile(fileName, []byte(test.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			// Set the mode explicitly, the umask must not decide it.
+			if err := os.Chmod(fileName, test.mode); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readSecretFile(fileName)
+			if test.fails {
+				if err == nil {
+					t.Fatalf("read a secret file with mode %v", test.mode)
+				}
+				if !strings.Contains(err.Error(), "chmod 600") {
+					t.Fatalf("error %q does not say how to fix it", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Fatalf("read %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	if _, err = readSecretFile(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("read a missing secret file")
+	}
+}
+
+func TestSecretSourceResolve(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("secret commands run through sh")
+	}
+	dir, err := ioutil.TempDir("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	secretFile := filepath.Join(dir, "key")
+	if err = ioutil.WriteFile(secretFile, []byte("from file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	openFile := filepath.Join(dir, "open")
+	if err = ioutil.WriteFile(openFile, []byte("from file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chmod(openFile, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const env = "DRIVER_IPFS_TEST_SECRET"
+	if err = os.Setenv(env, "from environment"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Unsetenv(env) }()
+
+	tests := []struct {
+		name   string
+		source SecretSource
+		want   string
+		origin string
+		fails  bool
+	}{
+		{name: "nothing", source: SecretSource{Name: "key"}},
+		{name: "unset environment", source: SecretSource{Name: "key", Env: "DRIVER_IPFS_TEST_UNSET"}},
+		{name: "inline", source: SecretSource{Name: "key", Inline: "inline"}, want: "inline", origin: "configuration"},
+		{
+			name:   "command",
+			source: SecretSource{Name: "key", Command: "printf 'from command\\n'", Inline: "inline"},
+			want:   "from command",
+			origin: "command",
+		},
+		{
+			name:   "file",
+			source: SecretSource{Name: "key", File: secretFile, Command: "printf 'from command'", Inline: "inline"},
+			want:   "from file",
+			origin: "file " + secretFile,
+		},
+		{
+			name:   "environment",
+			source: SecretSource{Name: "key", Env: env, File: secretFile, Command: "printf 'from command'", Inline: "inline"},
+			want:   "from environment",
+			origin: "environment " + env,
+		},
+		{name: "readable file", source: SecretSource{Name: "key", File: openFile, Inline: "inline"}, fails: true},
+		{name: "missing file", source: SecretSource{Name: "key", File: filepath.Join(dir, "missing")}, fails: true},
+		{name: "failing command", source: SecretSource{Name: "key", Command: "exit 3", Inline: "inline"}, fails: true},
+		{name: "silent command", source: SecretSource{Name: "key", Command: "true"}, fails: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, origin, err := test.source.Resolve()
+			if test.fails {
+				if err == nil {
+					t.Fatalf("resolved %q from %s", got, origin)
+				}
+				if !strings.HasPrefix(err.Error(), "key: ") {
+					t.Fatalf("error %q does not name the secret", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want || origin != test.origin {
+				t.Fatalf("resolved %q from %q, want %q from %q", got, origin, test.want, test.origin)
+			}
+			if configured := test.source.Configured(); configured != (test.want != "") {
+				t.Fatalf("configured is %v", configured)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// KeySharePrefix starts the text form of a key share.
+const KeySharePrefix = "DRIVER-IPFS-SHARE"
+
+// Sizes of the parts a key share carries besides its value.
+const (
+	shareSetIDSize    = 4
+	shareChecksumSize = 4
+)
+
+// KeyShare is one of the shares a key is split into with Shamir's secret sharing over GF(256).
+// Any Threshold shares of the same set restore the key, fewer reveal nothing about it.
+// The shared value is the key followed by a checksum, so that a wrong combination is detected.
+type KeyShare struct {
+	SetID     []byte
+	Threshold int
+	Index     byte
+	Value     []byte
+}
+
+// gf256Exp and gf256Log are the exponent and logarithm tables of GF(256)
+// with the AES polynomial x^8 + x^4 + x^3 + x + 1 and generator 3.
+var gf256Exp, gf256Log = gf256Tables()
+
+func gf256Tables() ([510]byte, [256]byte) {
+	var exp [510]byte
+	var log [256]byte
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		exp[i+255] = x
+		log[x] = byte(i)
+		// Multiply by the generator 3 = x + 1.
+		high := x & 0x80
+		doubled := x << 1
+		if high != 0 {
+			doubled ^= 0x1b
+		}
+		x ^= doubled
+	}
+	return exp, log
+}
+
+func gf256Mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gf256Exp[int(gf256Log[a])+int(gf256Log[b])]
+}
+
+func gf256Div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gf256Exp[int(gf256Log[a])+255-int(gf256Log[b])]
+}
+
+// SplitKey splits key into shares of which threshold are needed to restore it.
+func SplitKey(key string, shares int, threshold int) ([]KeyShare, error) {
+	if key == "" {
+		return nil, errors.New("the key is empty")
+	}
+	if threshold < 2 || shares < threshold || shares > 255 {
+		return nil, fmt.Errorf("invalid split of %d shares with threshold %d: need 2 <= threshold <= shares <= 255", shares, threshold)
+	}
+
+	setID := make([]byte, shareSetIDSize)
+	if _, err := io.ReadFull(rand.Reader, setID); err != nil {
+		return nil, err
+	}
+	checksum := sha256.Sum256([]byte(key))
+	secret := append([]byte(key), checksum[:shareChecksumSize]...)
+
+	result := make([]KeyShare, shares)
+	for i := range result {
+		result[i] = KeyShare{SetID: setID, Threshold: threshold, Index: byte(i + 1), Value: make([]byte, len(secret))}
+	}
+
+	// Every byte of the secret is the constant term of its own random polynomial.
+	coefficients := make([]byte, threshold-1)
+	for position, secretByte := range secret {
+		if _, err := io.ReadFull(rand.Reader, coefficients); err != nil {
+			return nil, err
+		}
+		for i := range result {
+			x := result[i].Index
+			// Horner's scheme, highest coefficient first.
+			var y byte
+			for c := len(coefficients) - 1; c >= 0; c-- {
+				y = gf256Mul(y, x) ^ coefficients[c]
+			}
+			result[i].Value[position] = gf256Mul(y, x) ^ secretByte
+		}
+	}
+	return result, nil
+}
+
+// CombineKeyShares restores a key from at least threshold shares of the same set.
+func CombineKeyShares(shares []KeyShare) (string, error) {
+	if len(shares) == 0 {
+		return "", errors.New("no key shares given")
+	}
+
+	first := shares[0]
+	seen := map[byte]bool{}
+	var used []KeyShare
+	for _, share := range shares {
+		if !bytes.Equal(share.SetID, first.SetID) || share.Threshold != first.Threshold || len(share.Value) != len(first.Value) {
+			return "", errors.New("the key shares do not belong to the same key")
+		}
+		if seen[share.Index] {
+			continue
+		}
+		seen[share.Index] = true
+		used = append(used, share)
+	}
+	if len(used) < first.Threshold {
+		return "", fmt.Errorf("%d different key shares given, %d are needed", len(used), first.Threshold)
+	}
+	used = used[:first.Threshold]
+
+	// Lagrange interpolation at x = 0; addition and subtraction are both XOR.
+	secret := make([]byte, len(first.Value))
+	for i, share := range used {
+		basis := byte(1)
+		for j, other := range used {
+			if i == j {
+				continue
+			}
+			basis = gf256Mul(basis, gf256Div(other.Index, other.Index^share.Index))
+		}
+		for position := range secret {
+			secret[position] ^= gf256Mul(share.Value[position], basis)
+		}
+	}
+
+	if len(secret) <= shareChecksumSize {
+		return "", errors.New("invalid key shares")
+	}
+	key := secret[:len(secret)-shareChecksumSize]
+	checksum := sha256.Sum256(key)
+	if !bytes.Equal(checksum[:shareChecksumSize], secret[len(key):]) {
+		return "", errors.New("the key shares do not combine to a valid key, one of them is damaged")
+	}
+	return string(key), nil
+}
+
+// String returns the text form of the share:
+// DRIVER-IPFS-SHARE:<set>:<threshold>:<index>:<value>.
+func (share KeyShare) String() string {
+	return strings.Join([]string{
+		KeySharePrefix,
+		hex.EncodeToString(share.SetID),
+		strconv.Itoa(share.Threshold),
+		strconv.Itoa(int(share.Index)),
+		base64.RawURLEncoding.EncodeToString(share.Value),
+	}, ":")
+}
+
+// ParseKeyShare parses the text form of a share.
+func ParseKeyShare(text string) (KeyShare, error) {
+	parts := strings.Split(strings.TrimSpace(text), ":")
+	if len(parts) != 5 || parts[0] != KeySharePrefix {
+		return KeyShare{}, errors.New("invalid key share: expected " + KeySharePrefix + ":<set>:<threshold>:<index>:<value>")
+	}
+	setID, err := hex.DecodeString(parts[1])
+	if err != nil || len(setID) != shareSetIDSize {
+		return KeyShare{}, errors.New("invalid key share: bad set")
+	}
+	threshold, err := strconv.Atoi(parts[2])
+	if err != nil || threshold < 2 {
+		return KeyShare{}, errors.New("invalid key share: bad threshold")
+	}
+	index, err := strconv.Atoi(parts[3])
+	if err != nil || index < 1 || index > 255 {
+		return KeyShare{}, errors.New("invalid key share: bad index")
+	}
+	value, err := base64.RawURLEncoding.DecodeString(parts[4])
+	if err != nil {
+		return KeyShare{}, fmt.Errorf("invalid key share: %v", err)
+	}
+	return KeyShare{SetID: setID, Threshold: threshold, Index: byte(index), Value: value}, nil
+}
+
+// CombineKeyShareTexts parses shares in text form and restores the key from them.
+func CombineKeyShareTexts(texts []string) (string, error) {
+	shares := make([]KeyShare, 0, len(texts))
+	for _, text := range texts {
+		share, err := ParseKeyShare(text)
+		if err != nil {
+			return "", err
+		}
+		shares = append(shares, share)
+	}
+	return CombineKeyShares(shares)
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import "testing"
+
+func TestGF256(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			product := gf256Mul(byte(a), byte(b))
+			if gf256Div(product, byte(b)) != byte(a) {
+				t.Fatalf("%d * %d / %d != %d", a, b, b, a)
+			}
+		}
+		if gf256Mul(byte(a), 0) != 0 || gf256Mul(byte(a), 1) != byte(a) {
+			t.Fatalf("%d * 0 or %d * 1 is wrong", a, a)
+		}
+	}
+	// 0x53 * 0xca = 0x01 with the AES polynomial.
+	if gf256Mul(0x53, 0xca) != 0x01 {
+		t.Fatalf("0x53 * 0xca = %#x, want 0x01", gf256Mul(0x53, 0xca))
+	}
+}
+
+func TestSplitKey(t *testing.T) {
+	tests := []struct {
+		shares    int
+		threshold int
+	}{
+		{shares: 2, threshold: 2},
+		{shares: 3, threshold: 2},
+		{shares: 5, threshold: 3},
+		{shares: 255, threshold: 255},
+	}
+	for _, test := range tests {
+		key := "correct horse battery staple"
+		shares, err := SplitKey(key, test.shares, test.threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(shares) != test.shares {
+			t.Fatalf("got %d shares, want %d", len(shares), test.shares)
+		}
+
+		// Every window of threshold shares, in text form and in reverse order, restores the key.
+		for start := 0; start+test.threshold <= len(shares); start++ {
+			var texts []string
+			for i := start + test.threshold - 1; i >= start; i-- {
+				texts = append(texts, shares[i].String())
+			}
+			combined, err := CombineKeyShareTexts(texts)
+			if err != nil {
+				t.Fatalf("%d of %d: %v", test.threshold, test.shares, err)
+			}
+			if combined != key {
+				t.Fatalf("%d of %d: combined %q", test.threshold, test.shares, combined)
+			}
+		}
+
+		// Fewer shares are refused, also when one of them is repeated.
+		fewer := append([]KeyShare{}, shares[:test.threshold-1]...)
+		if _, err := CombineKeyShares(fewer); err == nil {
+			t.Fatalf("%d of %d: combined %d shares", test.threshold, test.shares, len(fewer))
+		}
+		if _, err := CombineKeyShares(append(fewer, shares[0])); err == nil {
+			t.Fatalf("%d of %d: combined a repeated share", test.threshold, test.shares)
+		}
+	}
+}
+
+func TestCombineKeySharesRejects(t *testing.T) {
+	shares, err := SplitKey("correct horse", 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherShares, err := SplitKey("correct horse", 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	damaged := shares[1]
+	damaged.Value = flipBit(damaged.Value, 0)
+
+	tests := []struct {
+		name   string
+		shares []KeyShare
+	}{
+		{name: "none"},
+		{name: "other set", shares: []KeyShare{shares[0], otherShares[1]}},
+		{name: "damaged", shares: []KeyShare{shares[0], damaged}},
+		{name: "other threshold", shares: []KeyShare{shares[0], {SetID: shares[1].SetID, Threshold: 3, Index: 2, Value: shares[1].Value}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if key, err := CombineKeyShares(test.shares); err == nil {
+				t.Fatalf("combined %q, want an error", key)
+			}
+		})
+	}
+}
+
+func TestSplitKeyRejects(t *testing.T) {
+	tests := []struct {
+		key       string
+		shares    int
+		threshold int
+	}{
+		{key: "", shares: 3, threshold: 2},
+		{key: "key", shares: 3, threshold: 1},
+		{key: "key", shares: 2, threshold: 3},
+		{key: "key", shares: 256, threshold: 2},
+	}
+	for _, test := range tests {
+		if _, err := SplitKey(test.key, test.shares, test.threshold); err == nil {
+			t.Errorf("split %q into %d shares with threshold %d", test.key, test.shares, test.threshold)
+		}
+	}
+}
+
+func TestParseKeyShare(t *testing.T) {
+	shares, err := SplitKey("correct horse", 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := shares[2].String()
+	parsed, err := ParseKeyShare(" " + text + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.String() != text {
+		t.Fatalf("parsed %q, want %q", parsed, text)
+	}
+
+	for _, bad := range []string{
+		"",
+		"DRIVER-IPFS-SHARE:00112233:2:1",
+		"OTHER-SHARE:00112233:2:1:AAAA",
+		"DRIVER-IPFS-SHARE:0011:2:1:AAAA",
+		"DRIVER-IPFS-SHARE:00112233:1:1:AAAA",
+		"DRIVER-IPFS-SHARE:00112233:2:0:AAAA",
+		"DRIVER-IPFS-SHARE:00112233:2:256:AAAA",
+		"DRIVER-IPFS-SHARE:00112233:2:1:not base64!",
+	} {
+		if _, err := ParseKeyShare(bad); err == nil {
+			t.Errorf("parsed %q, want an error", bad)
+		}
+	}
+}
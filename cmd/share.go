@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+	"storj.io/uplink"
+)
+
+// shareCmd represents the share command.
+var shareCmd = &cobra.Command{
+	Use:   "share <hash>",
+	Short: "Command to share access to an existing backup.",
+	Long: `Command to create a serialized access restricted to the bucket and prefix of the backup behind the shareable hash.
+The access is download-only unless upload, list or delete are allowed with --allow.
+The backup is opened with the key of the storj configuration or an identity.
+Every shared access is recorded in the local share registry, see share list and share revoke.`,
+	Args: cobra.ExactArgs(1),
+	Run:  storjShare,
+}
+
+// shareListCmd represents the share list command.
+var shareListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Command to list the shared accesses recorded in the share registry.",
+	Long:  `Command to list the accesses shared by store --share, store --ticket and share, with their backup, permissions, validity and status.`,
+	Args:  cobra.NoArgs,
+	Run:   shareList,
+}
+
+// shareRevokeCmd represents the share revoke command.
+var shareRevokeCmd = &cobra.Command{
+	Use:   "revoke [id]",
+	Short: "Command to revoke a shared access.",
+	Long: `Command to revoke a shared access on the satellite, so that it and any restore ticket containing it stop working.
+The access is given by its id in the share registry, or directly with --access or --ticket, e.g. when it leaked.
+There may be a delay until the satellite refuses the access.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  storjRevokeShare,
+}
+
+// ShareResult is the result of the share command.
+type ShareResult struct {
+	BaseCID      string `json:"baseCID"`
+	Bucket       string `json:"bucket"`
+	Prefix       string `json:"prefix"`
+	SharedAccess string `json:"sharedAccess"`
+	ShareID      string `json:"shareID"`
+	Ticket       string `json:"ticket,omitempty"`
+}
+
+// ShareListResult is the result of the share list command.
+type ShareListResult struct {
+	Registry string        `json:"registry"`
+	Shares   []ShareRecord `json:"shares"`
+}
+
+// ShareRevokeResult is the result of the share revoke command.
+type ShareRevokeResult struct {
+	ID      string    `json:"id"`
+	BaseCID string    `json:"baseCID,omitempty"`
+	Revoked time.Time `json:"revoked"`
+}
+
+func init() {
+
+	// Setup the share command with its flags.
+	rootCmd.AddCommand(shareCmd)
+	shareCmd.Flags().StringP("ipfs", "i", "././config/ipfs_property_v01.json", "full filepath contaning IPFS configuration.")
+	shareCmd.Flags().BoolP("accesskey", "a", false, "Connect to storj using access key(default connection method is by using API Key).")
+	shareCmd.Flags().StringP("storj", "u", "././config/storj_config_v01.json", "full filepath contaning storj V3 configuration.")
+	shareCmd.Flags().String("identity-file", "", "file containing an identity the backup is encrypted to.")
+	shareCmd.Flags().StringSlice("allow", nil, "operations the shared access allows besides download: upload, list or delete.")
+	shareCmd.Flags().Bool("ticket", false, "create a restore ticket bundling the hash, the shared access and the decryption key of the backup.")
+	shareCmd.Flags().Bool("ticket-passphrase", false, "protect the restore ticket with a passphrase.")
+
+	shareCmd.AddCommand(shareListCmd)
+
+	shareCmd.AddCommand(shareRevokeCmd)
+	shareRevokeCmd.Flags().BoolP("accesskey", "a", false, "Connect to storj using access key(default connection method is by using API Key).")
+	shareRevokeCmd.Flags().StringP("storj", "u", "././config/storj_config_v01.json", "full filepath contaning storj V3 configuration, its access must be the one the share was created from.")
+	shareRevokeCmd.Flags().String("access", "", "serialized access to revoke instead of a share of the registry.")
+	shareRevokeCmd.Flags().String("ticket", "", "restore ticket whose access is revoked instead of a share of the registry.")
+}
+
+func storjShare(cmd *cobra.Command, args []string) {
+
+	// Process arguments from the CLI.
+	hash := args[0]
+	ipfsConfigfilePath, _ := cmd.Flags().GetString("ipfs")
+	fullFileNameStorj, _ := cmd.Flags().GetString("storj")
+	useAccessKey, _ := cmd.Flags().GetBool("accesskey")
+	identityFile, _ := cmd.Flags().GetString("identity-file")
+	createTicket, _ := cmd.Flags().GetBool("ticket")
+	protectTicket, _ := cmd.Flags().GetBool("ticket-passphrase")
+	shareAllow, _ := cmd.Flags().GetStringSlice("allow")
+
+	// Read storj network configurations from and external file and create a storj configuration object.
+	storjConfig := LoadStorjConfiguration(fullFileNameStorj)
+	storjConfig.ShareAllow = shareAllow
+
+	credentials := Credentials{
+		Key:        storjConfig.Key,
+		Identities: LoadIdentities(SecretSource{Name: "identity", Env: EnvIdentity, File: identityFile}),
+	}
+	if credentials.Empty() {
+		credentials.Key = PromptKey(false)
+	}
+
+	// Read IPFS instance's configurations from an external file and create an IPFS configuration object.
+	configIpfs := LoadIpfsProperty(ipfsConfigfilePath)
+
+	// Connect to storj network using the specified credentials.
+	access, project := ConnectToStorj(fullFileNameStorj, storjConfig, useAccessKey)
+	defer func() {
+		_ = project.Close()
+	}()
+
+	// Connect to IPFS using the specified credentials
+	ipfsShell := ConnectToIpfs(configIpfs)
+
+	// The location of the backup is only known from its pointer.
+	// Private backups keep it in the bucket, which the shared access has to cover too.
+	record, private := ReadPrivateEnvelope(project, storjConfig, hash)
+	if !private {
+		record = GetReaderDownload(ipfsShell, hash)
+	}
+	pointer := ReadPointer(record, credentials)
+	fmt.Fprintf(statusOut, "\nSharing backup %s of \"%s\"\n", pointer.BaseCID, pointer.FileName)
+
+	prefixes := ReadManifest(project, pointer).ReferencedPrefixes()
+	if private {
+		prefixes = append(prefixes, PrivateEnvelopeKey(storjConfig, hash))
+	}
+	result := ShareResult{
+		BaseCID:      pointer.BaseCID,
+		Bucket:       pointer.Bucket,
+		Prefix:       pointer.Prefix(),
+		SharedAccess: ShareAccess(access, storjConfig, pointer, prefixes),
+	}
+	result.ShareID = ShareFingerprint(result.SharedAccess)
+	if createTicket || protectTicket {
+		ticketPassphrase := ""
+		if protectTicket {
+			ticketPassphrase = TicketPassphrase(true)
+		}
+		result.Ticket = CreateTicket(hash, result.SharedAccess, pointer, ticketPassphrase)
+	}
+	PrintResult(result)
+}
+
+func shareList(cmd *cobra.Command, args []string) {
+
+	path, err := ShareRegistryPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	registry, err := LoadShareRegistry(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	result := ShareListResult{Registry: path, Shares: []ShareRecord{}}
+	now := time.Now()
+	fmt.Fprintf(statusOut, "%d shares in %s\n", len(registry.Shares), path)
+	for _, record := range registry.Shares {
+		fmt.Fprintf(statusOut, "%s\t%s\t%s/%s\t%s\t%s\t%s\n", record.ID, record.Status(now), record.Bucket, record.Prefix,
+			record.Permissions, describeWindow(record.NotBefore, record.NotAfter), record.Created.Format("2006-01-02 15:04:05"))
+		// The accesses themselves are not printed.
+		record.Access = ""
+		result.Shares = append(result.Shares, record)
+	}
+	PrintResult(result)
+}
+
+func storjRevokeShare(cmd *cobra.Command, args []string) {
+
+	// Process arguments from the CLI.
+	fullFileNameStorj, _ := cmd.Flags().GetString("storj")
+	useAccessKey, _ := cmd.Flags().GetBool("accesskey")
+	serializedAccess, _ := cmd.Flags().GetString("access")
+	ticketText, _ := cmd.Flags().GetString("ticket")
+
+	given := 0
+	for _, set := range []bool{len(args) == 1, serializedAccess != "", ticketText != ""} {
+		if set {
+			given++
+		}
+	}
+	if given != 1 {
+		log.Fatal("Specify the share to revoke by its id, --access or --ticket")
+	}
+
+	path, err := ShareRegistryPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	registry, err := LoadShareRegistry(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Find the access to revoke and its record, if any.
+	if ticketText != "" {
+		passphrase := ""
+		if IsSealedTicket(ticketText) {
+			passphrase = TicketPassphrase(false)
+		}
+		ticket, err := DecodeTicket(ticketText, passphrase)
+		if err != nil {
+			log.Fatal(err)
+		}
+		serializedAccess = ticket.Access
+	}
+	index := -1
+	if len(args) == 1 {
+		if index, err = registry.Find(args[0]); err != nil {
+			log.Fatal(err)
+		}
+		serializedAccess = registry.Shares[index].Access
+	} else {
+		index, _ = registry.Find(ShareFingerprint(serializedAccess))
+	}
+
+	sharedAccess, err := uplink.ParseAccess(serializedAccess)
+	if err != nil {
+		log.Fatal("Invalid shared access: ", err)
+	}
+
+	// Read storj network configurations from and external file and create a storj configuration object.
+	storjConfig := LoadStorjConfiguration(fullFileNameStorj)
+
+	// Connect to storj network using the specified credentials.
+	_, project := ConnectToStorj(fullFileNameStorj, storjConfig, useAccessKey)
+	defer func() {
+		_ = project.Close()
+	}()
+
+	if err = project.RevokeAccess(context.Background(), sharedAccess); err != nil {
+		log.Fatal("Could not revoke access: ", err)
+	}
+
+	result := ShareRevokeResult{ID: ShareFingerprint(serializedAccess), Revoked: time.Now()}
+	if index >= 0 {
+		registry.Shares[index].Revoked = &result.Revoked
+		result.BaseCID = registry.Shares[index].BaseCID
+		if err = registry.Save(path); err != nil {
+			fmt.Fprintln(statusOut, "Warning: could not update the share registry:", err)
+		}
+	}
+	fmt.Fprintf(statusOut, "Revoked share %s, the satellite may take a while to refuse it\n", result.ID)
+	PrintResult(result)
+}
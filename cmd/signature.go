@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Text prefixes of Ed25519 signing keys and of their public keys.
+const (
+	SigningKeyPrefix = "ED25519-SECRET-KEY:"
+	SignerPrefix     = "ed25519:"
+)
+
+// manifestSignatureContext separates manifest signatures from other uses of the signing key.
+const manifestSignatureContext = "driver-ipfs/manifest-signature/v1\n"
+
+// indexSignatureContext separates signatures of backup indexes from manifest signatures.
+const indexSignatureContext = "driver-ipfs/index-signature/v1\n"
+
+// States of the signature of a backup, as reported by download and verify.
+const (
+	SignatureValid     = "valid"
+	SignatureUnsigned  = "unsigned"
+	SignatureUntrusted = "untrusted"
+	SignatureInvalid   = "invalid"
+)
+
+// ManifestSignature is the Ed25519 signature of the base CID and manifest digest of a backup,
+// stored in its envelope. The manifest in turn lists the digest of every chunk.
+type ManifestSignature struct {
+	PublicKey []byte `json:"publicKey"`
+	Signature []byte `json:"signature"`
+}
+
+// SigningKey is the Ed25519 private key backups are signed with.
+type SigningKey struct {
+	privateKey ed25519.PrivateKey
+}
+
+// TrustPolicy decides which signatures download and verify accept.
+// In strict mode backups that are not signed by a trusted key are refused.
+type TrustPolicy struct {
+	TrustedKeys []ed25519.PublicKey
+	Strict      bool
+}
+
+// GenerateSigningKey creates a new random signing key.
+func GenerateSigningKey() (SigningKey, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	return SigningKey{privateKey: privateKey}, nil
+}
+
+// ParseSigningKey parses the text form of a signing key, as written by key generate.
+func ParseSigningKey(text string) (SigningKey, error) {
+	lines := keyLines(text)
+	if len(lines) != 1 {
+		return SigningKey{}, errors.New("invalid signing key: expected exactly one key")
+	}
+	seed, err := parseKeyText(lines[0], SigningKeyPrefix)
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("invalid signing key: %v", err)
+	}
+	return SigningKey{privateKey: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+// String returns the text form of the signing key.
+func (signingKey SigningKey) String() string {
+	return SigningKeyPrefix + base64.RawURLEncoding.EncodeToString(signingKey.privateKey.Seed())
+}
+
+// PublicKey returns the text form of the public key matching the signing key.
+func (signingKey SigningKey) PublicKey() string {
+	return FormatSigner(signingKey.privateKey.Public().(ed25519.PublicKey))
+}
+
+// FormatSigner returns the text form of a public signing key.
+func FormatSigner(publicKey []byte) string {
+	return SignerPrefix + base64.RawURLEncoding.EncodeToString(publicKey)
+}
+
+// ParseTrustedKeys parses a list of public signing keys in text form.
+func ParseTrustedKeys(texts []string) ([]ed25519.PublicKey, error) {
+	keys := make([]ed25519.PublicKey, 0, len(texts))
+	for _, text := range texts {
+		key, err := parseKeyText(text, SignerPrefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted key %q: %v", text, err)
+		}
+		keys = append(keys, ed25519.PublicKey(key))
+	}
+	return keys, nil
+}
+
+// manifestSignatureMessage is the message signed for a backup.
+func manifestSignatureMessage(baseCID string, manifestDigest []byte) []byte {
+	message := []byte(manifestSignatureContext + baseCID + "\n")
+	return append(message, manifestDigest...)
+}
+
+// SignManifest signs the base CID and manifest digest of a backup.
+func (signingKey SigningKey) SignManifest(baseCID string, manifestDigest []byte) *ManifestSignature {
+	return &ManifestSignature{
+		PublicKey: signingKey.privateKey.Public().(ed25519.PublicKey),
+		Signature: ed25519.Sign(signingKey.privateKey, manifestSignatureMessage(baseCID, manifestDigest)),
+	}
+}
+
+// SignIndex signs the digest of a backup index.
+func (signingKey SigningKey) SignIndex(indexDigest []byte) *ManifestSignature {
+	return &ManifestSignature{
+		PublicKey: signingKey.privateKey.Public().(ed25519.PublicKey),
+		Signature: ed25519.Sign(signingKey.privateKey, append([]byte(indexSignatureContext), indexDigest...)),
+	}
+}
+
+// Check returns the state of the signature of a backup and, if signed, the public key of the signer.
+func (policy TrustPolicy) Check(pointer BackupPointer, manifest Manifest) (string, string) {
+	if len(manifest.Digest) == 0 {
+		return SignatureUnsigned, ""
+	}
+	return policy.check(pointer.Signature, manifestSignatureMessage(pointer.BaseCID, manifest.Digest))
+}
+
+// CheckIndex returns the state of the signature of a backup index and, if signed, the public key of the signer.
+func (policy TrustPolicy) CheckIndex(signature *ManifestSignature, indexDigest []byte) (string, string) {
+	return policy.check(signature, append([]byte(indexSignatureContext), indexDigest...))
+}
+
+// check returns the state of a signature of message.
+func (policy TrustPolicy) check(signature *ManifestSignature, message []byte) (string, string) {
+	if signature == nil {
+		return SignatureUnsigned, ""
+	}
+	signer := FormatSigner(signature.PublicKey)
+	if len(signature.PublicKey) != ed25519.PublicKeySize || !ed25519.Verify(signature.PublicKey, message, signature.Signature) {
+		return SignatureInvalid, signer
+	}
+	for _, trusted := range policy.TrustedKeys {
+		if bytes.Equal(trusted, signature.PublicKey) {
+			return SignatureValid, signer
+		}
+	}
+	return SignatureUntrusted, signer
+}
+
+// CheckSignature checks and reports the signature of a backup before it is restored.
+// In strict mode anything but a valid signature by a trusted key is fatal,
+// otherwise it is only warned about.
+func CheckSignature(pointer BackupPointer, manifest Manifest, policy TrustPolicy) (string, string) {
+
+	state, signer := policy.Check(pointer, manifest)
+
+	var problem string
+	switch state {
+	case SignatureValid:
+		fmt.Fprintln(statusOut, "Signed by\t: ", signer)
+		return state, signer
+	case SignatureUnsigned:
+		problem = "the backup is not signed"
+	case SignatureUntrusted:
+		problem = fmt.Sprintf("the backup is signed by %s, which is not a trusted key", signer)
+	case SignatureInvalid:
+		problem = fmt.Sprintf("the signature of the backup by %s does not match, its manifest may have been tampered with", signer)
+	}
+
+	if policy.Strict {
+		log.Fatal("Refusing backup ", pointer.BaseCID, ": ", problem)
+	}
+	fmt.Fprintln(statusOut, "Warning:", problem)
+	return state, signer
+}
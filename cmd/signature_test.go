@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestSignatureCheck(t *testing.T) {
+	signingKey, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted, err := ParseTrustedKeys([]string{signingKey.PublicKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256([]byte("manifest"))
+	otherDigest := sha256.Sum256([]byte("tampered manifest"))
+	manifest := Manifest{BaseCID: "QmBase", Digest: digest[:]}
+	signature := signingKey.SignManifest("QmBase", digest[:])
+	forged := &ManifestSignature{PublicKey: signature.PublicKey, Signature: flipBit(signature.Signature, 7)}
+
+	tests := []struct {
+		name      string
+		policy    TrustPolicy
+		signature *ManifestSignature
+		baseCID   string
+		manifest  Manifest
+		want      string
+	}{
+		{name: "trusted", policy: TrustPolicy{TrustedKeys: trusted}, signature: signature, want: SignatureValid},
+		{name: "untrusted", signature: signature, want: SignatureUntrusted},
+		{name: "other trusted key", policy: TrustPolicy{TrustedKeys: []ed25519.PublicKey{otherKey.privateKey.Public().(ed25519.PublicKey)}}, signature: signature, want: SignatureUntrusted},
+		{name: "unsigned", policy: TrustPolicy{TrustedKeys: trusted}, want: SignatureUnsigned},
+		{name: "legacy manifest", policy: TrustPolicy{TrustedKeys: trusted}, signature: signature, manifest: Manifest{BaseCID: "QmBase"}, want: SignatureUnsigned},
+		{name: "tampered manifest", policy: TrustPolicy{TrustedKeys: trusted}, signature: signature, manifest: Manifest{BaseCID: "QmBase", Digest: otherDigest[:]}, want: SignatureInvalid},
+		{name: "other base CID", policy: TrustPolicy{TrustedKeys: trusted}, signature: signature, baseCID: "QmOther", want: SignatureInvalid},
+		{name: "forged signature", policy: TrustPolicy{TrustedKeys: trusted}, signature: forged, want: SignatureInvalid},
+		{name: "short public key", policy: TrustPolicy{TrustedKeys: trusted}, signature: &ManifestSignature{PublicKey: signature.PublicKey[:8], Signature: signature.Signature}, want: SignatureInvalid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pointer := BackupPointer{BaseCID: "QmBase", Signature: test.signature}
+			if test.baseCID != "" {
+				pointer.BaseCID = test.baseCID
+			}
+			checked := manifest
+			if test.manifest.BaseCID != "" {
+				checked = test.manifest
+			}
+			state, signer := test.policy.Check(pointer, checked)
+			if state != test.want {
+				t.Fatalf("got %s, want %s", state, test.want)
+			}
+			if state != SignatureUnsigned && signer != FormatSigner(test.signature.PublicKey) {
+				t.Fatalf("signer %q", signer)
+			}
+		})
+	}
+}
+
+func TestSignatureContexts(t *testing.T) {
+	signingKey, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := TrustPolicy{TrustedKeys: []ed25519.PublicKey{signingKey.privateKey.Public().(ed25519.PublicKey)}}
+	digest := sha256.Sum256([]byte("index"))
+
+	if state, _ := policy.CheckIndex(signingKey.SignIndex(digest[:]), digest[:]); state != SignatureValid {
+		t.Fatalf("index signature is %s", state)
+	}
+	// A signature of a manifest must not pass for one of an index, or the other way around.
+	if state, _ := policy.CheckIndex(signingKey.SignManifest("", digest[:]), digest[:]); state != SignatureInvalid {
+		t.Fatalf("manifest signature checked as an index signature is %s", state)
+	}
+	pointer := BackupPointer{Signature: signingKey.SignIndex(digest[:])}
+	if state, _ := policy.Check(pointer, Manifest{Digest: digest[:]}); state != SignatureInvalid {
+		t.Fatalf("index signature checked as a manifest signature is %s", state)
+	}
+}
+
+func TestParseSigningKey(t *testing.T) {
+	signingKey, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseSigningKey("# signing key\n" + signingKey.String() + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.PublicKey() != signingKey.PublicKey() {
+		t.Fatalf("parsed %s, want %s", parsed.PublicKey(), signingKey.PublicKey())
+	}
+
+	for _, bad := range []string{"", signingKey.PublicKey(), signingKey.String() + "\n" + signingKey.String()} {
+		if _, err := ParseSigningKey(bad); err == nil {
+			t.Errorf("parsed %q, want an error", bad)
+		}
+	}
+	if _, err := ParseTrustedKeys([]string{signingKey.String()}); err == nil {
+		t.Error("parsed a signing key as a trusted key")
+	}
+}
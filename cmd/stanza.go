@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Text prefixes of X25519 recipient (public) keys and identities (private keys).
+const (
+	RecipientPrefix = "x25519:"
+	IdentityPrefix  = "X25519-SECRET-KEY:"
+)
+
+// recipientWrapInfo separates the keys derived for recipient stanzas from other uses.
+const recipientWrapInfo = "driver-ipfs/x25519"
+
+// Recipient is the X25519 public key a data key can be encrypted to.
+type Recipient struct {
+	publicKey []byte
+}
+
+// Identity is the X25519 private key of a recipient.
+type Identity struct {
+	privateKey []byte
+	publicKey  []byte
+}
+
+// RecipientStanza is a data key encrypted to one recipient, age-style:
+// an ephemeral X25519 key agreement with the recipient key derives the key
+// that seals the data key with ChaCha20-Poly1305.
+// Stanzas do not name their recipient, identities simply try all of them.
+type RecipientStanza struct {
+	Ephemeral []byte `json:"ephemeral"`
+	Key       []byte `json:"key"`
+}
+
+// GenerateIdentity creates a new random identity.
+func GenerateIdentity() (*Identity, error) {
+	privateKey := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, privateKey); err != nil {
+		return nil, err
+	}
+	return newIdentity(privateKey)
+}
+
+func newIdentity(privateKey []byte) (*Identity, error) {
+	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{privateKey: privateKey, publicKey: publicKey}, nil
+}
+
+// String returns the text form of the identity.
+func (identity *Identity) String() string {
+	return IdentityPrefix + base64.RawURLEncoding.EncodeToString(identity.privateKey)
+}
+
+// Recipient returns the public key matching the identity.
+func (identity *Identity) Recipient() Recipient {
+	return Recipient{publicKey: identity.publicKey}
+}
+
+// String returns the text form of the recipient.
+func (recipient Recipient) String() string {
+	return RecipientPrefix + base64.RawURLEncoding.EncodeToString(recipient.publicKey)
+}
+
+// ParseRecipient parses the text form of a recipient.
+func ParseRecipient(text string) (Recipient, error) {
+	publicKey, err := parseKeyText(text, RecipientPrefix)
+	if err != nil {
+		return Recipient{}, fmt.Errorf("invalid recipient %q: %v", text, err)
+	}
+	return Recipient{publicKey: publicKey}, nil
+}
+
+// ParseRecipients parses a list of recipients in text form.
+func ParseRecipients(texts []string) ([]Recipient, error) {
+	recipients := make([]Recipient, 0, len(texts))
+	for _, text := range texts {
+		recipient, err := ParseRecipient(text)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// ParseIdentities parses the identities of an identity file.
+// Empty lines and lines starting with # are ignored.
+func ParseIdentities(data string) ([]*Identity, error) {
+	var identities []*Identity
+	for _, line := range keyLines(data) {
+		privateKey, err := parseKeyText(line, IdentityPrefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity: %v", err)
+		}
+		identity, err := newIdentity(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	if len(identities) == 0 {
+		return nil, errors.New("no identity found")
+	}
+	return identities, nil
+}
+
+// keyLines returns the lines of a key file, without empty lines and # comments.
+func keyLines(data string) []string {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// parseKeyText decodes a 32 byte key following prefix.
+func parseKeyText(text string, prefix string) ([]byte, error) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, prefix) {
+		return nil, fmt.Errorf("expected prefix %q", prefix)
+	}
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(text, prefix))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != curve25519.PointSize {
+		return nil, fmt.Errorf("expected %d bytes, got %d", curve25519.PointSize, len(key))
+	}
+	return key, nil
+}
+
+// Wrap encrypts dataKey to the recipient.
+func (recipient Recipient) Wrap(dataKey []byte) (RecipientStanza, error) {
+	ephemeralSecret := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, ephemeralSecret); err != nil {
+		return RecipientStanza{}, err
+	}
+	ephemeral, err := curve25519.X25519(ephemeralSecret, curve25519.Basepoint)
+	if err != nil {
+		return RecipientStanza{}, err
+	}
+	shared, err := curve25519.X25519(ephemeralSecret, recipient.publicKey)
+	if err != nil {
+		return RecipientStanza{}, err
+	}
+
+	aead, err := stanzaAEAD(shared, ephemeral, recipient.publicKey)
+	if err != nil {
+		return RecipientStanza{}, err
+	}
+	// Every stanza uses a fresh key, so a zero nonce is safe.
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return RecipientStanza{
+		Ephemeral: ephemeral,
+		Key:       aead.Seal(nil, nonce, dataKey, nil),
+	}, nil
+}
+
+// Unwrap decrypts the data key of a stanza encrypted to the identity.
+func (identity *Identity) Unwrap(stanza RecipientStanza) ([]byte, error) {
+	shared, err := curve25519.X25519(identity.privateKey, stanza.Ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := stanzaAEAD(shared, stanza.Ephemeral, identity.publicKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return aead.Open(nil, nonce, stanza.Key, nil)
+}
+
+// stanzaAEAD derives the key sealing a stanza from the shared secret of the key agreement.
+func stanzaAEAD(shared, ephemeral, publicKey []byte) (cipherAEAD, error) {
+	salt := append(append([]byte{}, ephemeral...), publicKey...)
+	wrapKey := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(recipientWrapInfo)), wrapKey); err != nil {
+		return nil, err
+	}
+	return chacha20poly1305.New(wrapKey)
+}
+
+// cipherAEAD is the subset of cipher.AEAD used for stanzas.
+type cipherAEAD interface {
+	Seal(dst, nonce, plaintext, additionalData []byte) []byte
+	Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error)
+}
+
+// WrapForRecipients encrypts dataKey to every recipient.
+func WrapForRecipients(recipients []Recipient, dataKey []byte) ([]RecipientStanza, error) {
+	stanzas := make([]RecipientStanza, 0, len(recipients))
+	for _, recipient := range recipients {
+		stanza, err := recipient.Wrap(dataKey)
+		if err != nil {
+			return nil, err
+		}
+		stanzas = append(stanzas, stanza)
+	}
+	return stanzas, nil
+}
+
+// unwrapWithIdentities tries every identity on every stanza.
+func unwrapWithIdentities(identities []*Identity, stanzas []RecipientStanza) ([]byte, bool) {
+	for _, identity := range identities {
+		for _, stanza := range stanzas {
+			if dataKey, err := identity.Unwrap(stanza); err == nil && len(dataKey) == DataKeySize {
+				return dataKey, true
+			}
+		}
+	}
+	return nil, false
+}
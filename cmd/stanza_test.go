@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRecipientStanzas(t *testing.T) {
+	alice, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	eve, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stanzas, err := WrapForRecipients([]Recipient{alice.Recipient(), bob.Recipient()}, dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stanzas) != 2 {
+		t.Fatalf("got %d stanzas, want 2", len(stanzas))
+	}
+
+	tampered := []RecipientStanza{
+		{Ephemeral: stanzas[0].Ephemeral, Key: flipBit(stanzas[0].Key, 3)},
+		{Ephemeral: flipBit(stanzas[1].Ephemeral, 3), Key: stanzas[1].Key},
+	}
+	tests := []struct {
+		name       string
+		identities []*Identity
+		stanzas    []RecipientStanza
+		opens      bool
+	}{
+		{name: "first recipient", identities: []*Identity{alice}, stanzas: stanzas, opens: true},
+		{name: "second recipient", identities: []*Identity{bob}, stanzas: stanzas, opens: true},
+		{name: "one of several identities", identities: []*Identity{eve, bob}, stanzas: stanzas, opens: true},
+		{name: "other identity", identities: []*Identity{eve}, stanzas: stanzas},
+		{name: "no identity", stanzas: stanzas},
+		{name: "no stanza", identities: []*Identity{alice}},
+		{name: "tampered", identities: []*Identity{alice, bob}, stanzas: tampered},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			unwrapped, ok := unwrapWithIdentities(test.identities, test.stanzas)
+			if ok != test.opens {
+				t.Fatalf("opened %v, want %v", ok, test.opens)
+			}
+			if ok && !bytes.Equal(unwrapped, dataKey) {
+				t.Fatal("unwrapped another data key")
+			}
+		})
+	}
+}
+
+func TestParseRecipient(t *testing.T) {
+	identity, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := identity.Recipient().String()
+
+	recipient, err := ParseRecipient("  " + text + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recipient.String() != text {
+		t.Fatalf("parsed %q, want %q", recipient, text)
+	}
+
+	for _, bad := range []string{
+		"",
+		text[len(RecipientPrefix):],
+		identity.String(),
+		RecipientPrefix + "not base64!",
+		RecipientPrefix + "AAAA",
+	} {
+		if _, err := ParseRecipient(bad); err == nil {
+			t.Errorf("parsed %q, want an error", bad)
+		}
+	}
+}
+
+func TestParseIdentities(t *testing.T) {
+	first, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identities, err := ParseIdentities("# created by key generate\n\n" + first.String() + "\n" + second.String() + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 2 || identities[0].String() != first.String() || identities[1].Recipient().String() != second.Recipient().String() {
+		t.Fatalf("parsed %v", identities)
+	}
+
+	for _, bad := range []string{"", "# only a comment\n", first.Recipient().String()} {
+		if _, err := ParseIdentities(bad); err == nil {
+			t.Errorf("parsed %q, want an error", bad)
+		}
+	}
+}
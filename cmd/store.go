@@ -2,37 +2,47 @@ package cmd
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
-	"os"
-	"path/filepath"
+	"path"
 	"strconv"
+	"time"
 
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"encoding/base64"
 	shell "github.com/ipfs/go-ipfs-api"
 	chunker "github.com/ipfs/go-ipfs-chunker"
 	"github.com/spf13/cobra"
+	"storj.io/uplink"
 )
 
 // storeCmd represents the store command.
 var storeCmd = &cobra.Command{
 	Use:   "store",
 	Short: "Command to upload data to storj V3 network.",
-	Long:  `Command to connect to desired IPFS account and back-up the complete data to given Storj Bucket.`,
-	Run:   ipfsStore,
+	Long: `Command to connect to desired IPFS account and back-up the complete data to given Storj Bucket.
+With --mfs a directory of the IPFS Mutable File System is backed up with the path of every file.
+With --dag the DAG below a CID is backed up as its CAR export, which restores every block and CID as they were.
+With --ipns the backup is published as the latest under its --index-name in an index under an IPNS name of the node.
+With --private nothing is published to IPFS, the shareable hash is only known to the bucket.
+With --key-layout hmac the objects are named after keyed hashes of the CIDs, which then only appear in the encrypted manifest.
+With --incremental only the chunks that changed since the previous backup of the same source are uploaded,
+the others are referenced from the backups they were stored with.`,
+	Run: ipfsStore,
 }
 
 // DownCmd represents the download command.
 var DownCmd = &cobra.Command{
 	Use:   "download",
 	Short: "Command to download data from storj V3 network.",
-	Long:  `Command to download data from the Storj Bucket using the Hash.`,
-	Run:   storjDownload,
+	Long: `Command to download data from the Storj Bucket using the Hash.
+With --source a version of a source is restored from the catalog instead, the latest one
+unless --version or --at select an earlier one.
+With --ipns the latest backup listed under --index-name is found in the backup index published by store --ipns.
+Backups of DAGs are restored as CAR files, or imported into the IPFS node with --import.`,
+	Run: storjDownload,
 }
 
 func init() {
@@ -44,13 +54,41 @@ func init() {
 	var defaultStorjFile string
 	var defaultStorjDownloadFile string
 	storeCmd.Flags().BoolP("accesskey", "a", false, "Connect to storj using access key(default connection method is by using API Key).")
-	storeCmd.Flags().BoolP("share", "s", false, "For generating share access of the uploaded backup file.")
+	storeCmd.Flags().BoolP("share", "s", false, "For generating share access of the uploaded backup file, restricted to its prefix.")
 	storeCmd.Flags().StringVarP(&defaultIpfsFile, "ipfs", "i", "././config/ipfs_property_v01.json", "full filepath contaning IPFS configuration.")
 	storeCmd.Flags().StringVarP(&defaultStorjFile, "storj", "u", "././config/storj_config_v01.json", "full filepath contaning storj V3 configuration.")
+	storeCmd.Flags().String("input", "", "file to back-up, or - to read from stdin (overrides path of the IPFS configuration).")
+	storeCmd.Flags().StringSlice("allow", nil, "operations the shared access allows besides download: upload, list or delete.")
+	storeCmd.Flags().Bool("ticket", false, "create a restore ticket bundling the hash, a shared access and the decryption key of the backup.")
+	storeCmd.Flags().Bool("ticket-passphrase", false, "protect the restore ticket with a passphrase.")
+	storeCmd.Flags().Bool("incremental", false, "reuse the unchanged chunks of the previous backup of the same source instead of uploading them again.")
+	storeCmd.Flags().String("mfs", "", "back up this directory of the IPFS Mutable File System instead of a file.")
+	storeCmd.Flags().Bool("private", false, "keep the envelope of the backup in the bucket only, nothing is published to IPFS.")
+	storeCmd.Flags().String("ipns", "", "publish the backup as the latest of its index name in the index under this IPNS key of the node, e.g. self.")
+	storeCmd.Flags().String("index-name", "", "name the backup is listed under in the index published with --ipns (default the file name of the backup).")
+	storeCmd.Flags().String("key-layout", "", "name objects after their CIDs (cid) or after HMACs of the CIDs under the key (hmac).")
+	storeCmd.Flags().String("dag", "", "back up the DAG below this CID as its CAR export instead of a file.")
+	storeCmd.Flags().String("source", "", "name the backups of the input are recorded under (default the absolute path of the input).")
 	DownCmd.Flags().StringVarP(&defaultIpfsFile, "ipfs", "i", "././config/ipfs_property_v01.json", "full filepath contaning IPFS configuration.")
 	DownCmd.Flags().BoolP("accesskey", "a", false, "Connect to storj using access key(default connection method is by using API Key).")
 	DownCmd.Flags().StringVarP(&defaultStorjFile, "storj", "u", "././config/storj_config_v01.json", "full filepath contaning storj V3 configuration.")
 	DownCmd.Flags().StringVarP(&defaultStorjDownloadFile, "storjDown", "d", "././config/storj_download_v01.json", "Download data from stroj")
+	DownCmd.Flags().String("dest", "", "file or directory to restore into, or - for stdout (overrides downloadPath of the download configuration).")
+	DownCmd.Flags().String("overwrite", "", "policy when the destination exists: fail, overwrite, rename or skip (default fail).")
+	DownCmd.Flags().Bool("strict", false, "refuse backups that are not signed by a trusted key.")
+	DownCmd.Flags().StringSlice("key-share", nil, "share of the key created by key split, repeated until the threshold is reached.")
+	DownCmd.Flags().String("key-shares-file", "", "file containing shares of the key, one per line.")
+	DownCmd.Flags().String("ticket", "", "restore ticket created by store --ticket or share --ticket, no other configuration is needed.")
+	DownCmd.Flags().String("ticket-file", "", "file containing a restore ticket.")
+	DownCmd.Flags().String("mfs", "", "rebuild backups of MFS in this MFS directory instead of a local directory.")
+	DownCmd.Flags().Bool("add", false, "add the restored content to the IPFS node with the parameters its base CID was computed with.")
+	DownCmd.Flags().Bool("import", false, "import backups of DAGs into the IPFS node with dag import instead of writing CAR files.")
+	DownCmd.Flags().Int("car-version", 0, "version of the CAR files backups of DAGs are written as, 1 or 2 (default 1).")
+	DownCmd.Flags().String("source", "", "restore a version of this source from the catalog instead of the hash, see history.")
+	DownCmd.Flags().String("ipns", "", "restore the latest backup of --index-name from the backup index published under this IPNS name instead of the hash.")
+	DownCmd.Flags().String("index-name", "", "with --ipns, restore the latest backup listed under this name.")
+	DownCmd.Flags().String("at", "", "with --source, restore the version backed up at this time: a day (2006-01-02), an RFC3339 time or relative like -3d.")
+	DownCmd.Flags().Int("version", 0, "with --source, restore this version, as numbered by history.")
 }
 
 func ipfsStore(cmd *cobra.Command, args []string) {
@@ -60,138 +98,468 @@ func ipfsStore(cmd *cobra.Command, args []string) {
 	fullFileNameStorj, _ := cmd.Flags().GetString("storj")
 	useAccessKey, _ := cmd.Flags().GetBool("accesskey")
 	useAccessShare, _ := cmd.Flags().GetBool("share")
+	inputPath, _ := cmd.Flags().GetString("input")
+	createTicket, _ := cmd.Flags().GetBool("ticket")
+	shareAllow, _ := cmd.Flags().GetStringSlice("allow")
+	protectTicket, _ := cmd.Flags().GetBool("ticket-passphrase")
+	incremental, _ := cmd.Flags().GetBool("incremental")
+	sourceName, _ := cmd.Flags().GetString("source")
+	mfsRoot, _ := cmd.Flags().GetString("mfs")
+	dagRoot, _ := cmd.Flags().GetString("dag")
+	ipnsKey, _ := cmd.Flags().GetString("ipns")
+	indexName, _ := cmd.Flags().GetString("index-name")
+	private, _ := cmd.Flags().GetBool("private")
+	keyLayout, _ := cmd.Flags().GetString("key-layout")
+
+	given := 0
+	for _, option := range []string{inputPath, mfsRoot, dagRoot} {
+		if option != "" {
+			given++
+		}
+	}
+	if given > 1 {
+		log.Fatal("Back up either a file with --input, an MFS directory with --mfs or a DAG with --dag")
+	}
+
+	// Ask for the passphrase of the ticket before the upload starts.
+	var ticketPassphrase string
+	if protectTicket {
+		createTicket = true
+		ticketPassphrase = TicketPassphrase(true)
+	}
 
 	// Read IPFS instance's configurations from an external file and create an IPFS configuration object.
 	configIpfs := LoadIpfsProperty(ipfsConfigfilePath)
+	addParams := configIpfs.AddParams()
+	if ipnsKey != "" {
+		configIpfs.IPNSKey = ipnsKey
+	}
+
+	// The input flag takes precedence over the configured path.
+	if inputPath != "" {
+		configIpfs.Path = inputPath
+	}
 
 	// Read storj network configurations from and external file and create a storj configuration object.
 	storjConfig := LoadStorjConfiguration(fullFileNameStorj)
 
+	if private {
+		storjConfig.Private = true
+	}
+	if storjConfig.Private && configIpfs.IPNSKey != "" {
+		log.Fatal("Private backups are not published to IPFS, they can not be listed in an index under an IPNS name")
+	}
+	if keyLayout != "" {
+		storjConfig.KeyLayout = keyLayout
+	}
+	storjConfig.ShareAllow = shareAllow
+
+	recipients, signingKey := StoreKeys(storjConfig)
+
+	// Ask for the encryption key when it is not configured anywhere
+	// and the backup would not be encrypted to any recipient either.
+	// Incremental backups always need it, the catalog of sources is encrypted with it,
+	// and so does the hmac layout, the object names are keyed with it.
+	if storjConfig.Key == "" && (len(recipients) == 0 || incremental || storjConfig.KeyLayout == KeyLayoutHMAC) {
+		storjConfig.Key = PromptKey(true)
+	}
+	namer, err := NewObjectNamer(storjConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Snapshots are recorded under the name of their source.
+	if sourceName == "" && mfsRoot != "" {
+		sourceName = MFSSourcePrefix + path.Clean("/"+mfsRoot)
+	}
+	if sourceName == "" && dagRoot != "" {
+		sourceName = DAGSourcePrefix + dagRoot
+	}
+	if sourceName == "" {
+		var err error
+		if sourceName, err = SourceLabel(configIpfs.Path); err != nil && incremental {
+			log.Fatal(err)
+		}
+	}
+
 	// Connect to storj network using the specified credentials.
 	access, project := ConnectToStorj(fullFileNameStorj, storjConfig, useAccessKey)
+	defer func() {
+		_ = project.Close()
+	}()
 
 	// Connect to IPFS using the specified credentials
 	ipfsShell := ConnectToIpfs(configIpfs)
 
-	fileHandle := GetReader(ipfsShell, configIpfs)
-
-	fmt.Println("\nReading content from the file:", configIpfs.Path)
-
-	// Get file name from the file path from configration file.
-	_, lastFileName := filepath.Split(configIpfs.Path)
+	// Open the source, which is read exactly once.
+	// The files of an MFS directory are read one after the other, a DAG as its CAR export.
+	var fileHandle io.ReadCloser
+	var lastFileName string
+	var sourceSize int64
+	var mfsTree *MFSTree
+	var dag *ManifestDAG
+	switch {
+	case dagRoot != "":
+		export, err := ExportDAG(ipfsShell, dagRoot)
+		if err != nil {
+			log.Fatalf("Could not export DAG %s: %v", dagRoot, err)
+		}
+		fileHandle = export
+		dag = &ManifestDAG{Root: dagRoot, Format: DAGFormatCARv1}
+		lastFileName = DAGFileName(dagRoot)
+		fmt.Fprintln(statusOut, "\nExporting DAG:", dagRoot)
+	case mfsRoot != "":
+		tree, err := WalkMFS(ipfsShell, mfsRoot)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mfsTree = &tree
+		fileHandle = OpenMFSReader(ipfsShell, tree)
+		lastFileName = MFSName(tree.Root)
+		sourceSize = tree.Size()
+		fmt.Fprintf(statusOut, "\nReading %d files from MFS: %s (%s)\n", tree.Files(), tree.Root, tree.RootCID)
+	default:
+		fileHandle = GetReader(ipfsShell, configIpfs)
+		lastFileName = SourceName(configIpfs.Path)
+		sourceSize = SourceSize(configIpfs)
+		fmt.Fprintln(statusOut, "\nReading content from:", configIpfs.Path)
+	}
 
-	// Create encrypt Base CID
-	encryptCID, _ := ipfsShell.Add(fileHandle, shell.OnlyHash(true))
+	start := time.Now()
 
-	// Open the uploaded file
-	file, err1 := os.Open(configIpfs.Path)
-	if err1 != nil {
-		fmt.Println(err1)
+	// Every backup is encrypted with its own random data key.
+	dataKey, err := NewDataKey()
+	if err != nil {
+		log.Fatal("Could not generate data key: ", err)
 	}
 
-	// Get total size of uploaded file
-	statFile, err4 := file.Stat()
-	if err4 != nil {
-		fmt.Println(err4)
+	// Every backup is recorded in the history of its source, which is encrypted with the key.
+	// Incremental backups reuse the chunks of the latest snapshot.
+	var catalog *Catalog
+	var history SourceHistory
+	var reusable map[string]ManifestChunk
+	switch {
+	case storjConfig.Key == "":
+		fmt.Fprintln(statusOut, "Not recording the backup in the history of its source, that needs the key")
+	case sourceName == "":
+		fmt.Fprintln(statusOut, "Not recording the backup in the history of its source, name the source with --source")
+	default:
+		if catalog, err = OpenCatalog(project, storjConfig, storjConfig.Key); err != nil {
+			log.Fatal(err)
+		}
+		if history, err = catalog.Load(sourceName); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if incremental {
+		if previous := history.Latest(); previous != nil {
+			fmt.Fprintf(statusOut, "Incremental backup of %s, previous backup %s of %s\n", sourceName, previous.BaseCID, previous.Created.Format("2006-01-02 15:04:05"))
+			previousPointer := previous.Pointer(storjConfig.Bucket)
+			reusable = ReusableChunks(previousPointer, ReadManifest(project, previousPointer))
+		} else {
+			fmt.Fprintf(statusOut, "No previous backup of %s, storing it in full\n", sourceName)
+		}
 	}
-	fileSize := statFile.Size()
 
 	givenSize, _ := strconv.ParseInt(configIpfs.ChunkSize, 0, 64)
+	manifest := StoreData(ipfsShell, project, storjConfig, fileHandle, StoreOptions{
+		ChunkSize: givenSize,
+		Add:       addParams,
+		Size:      sourceSize,
+		DataKey:   dataKey,
+		Reusable:  reusable,
+		Namer:     namer,
+		Progress:  progressPrinter(cmd),
+	})
+	if err = fileHandle.Close(); err != nil {
+		log.Fatal(err)
+	}
+	encryptCID := manifest.BaseCID
+	manifest.FileName = lastFileName
+	manifest.Source = sourceName
+	manifest.MFS = mfsTree
+	manifest.DAG = dag
+
+	// An input identical to an earlier snapshot is that backup, storing it again would replace its manifest.
+	if incremental {
+		if unchanged := history.Find(encryptCID); unchanged != nil {
+			storeUnchanged(access, project, storjConfig, catalog, history, *unchanged, manifest, useAccessShare, createTicket, ticketPassphrase, start)
+			return
+		}
+	}
 
-	// Generate the number of chunk files
-	noOfChunkFiles := int(fileSize/givenSize) + 1
+	envelope, configHash := PublishBackup(project, ipfsShell, storjConfig, recipients, signingKey, dataKey, manifest)
+
+	result := StoreResult{
+		BaseCID:     encryptCID,
+		PointerHash: configHash,
+		Bucket:      storjConfig.Bucket,
+		Prefix:      storjConfig.UploadPath + manifest.ObjectName() + "/",
+		FileName:    lastFileName,
+		Bytes:       manifest.Size,
+		Chunks:      len(manifest.Chunks),
+		Reused:      manifest.ReusedChunks(),
+	}
+	if signingKey != nil {
+		result.Signer = signingKey.PublicKey()
+	}
+
+	// The index is public, so it lists backups under a chosen name or their file name, never under their source.
+	if configIpfs.IPNSKey != "" {
+		if indexName == "" {
+			indexName = lastFileName
+		}
+		result.IPNSName = PublishIndex(ipfsShell, configIpfs.IPNSKey, indexName, IndexEntry{
+			Hash:     configHash,
+			BaseCID:  envelope.BaseCID,
+			FileName: lastFileName,
+			Created:  start.UTC(),
+		}, signingKey)
+	}
 
-	// Divided total uploaded file data into chunks DAG.
-	chunkFile := chunker.NewSizeSplitter(file, givenSize)
+	// Create restricted shareable serialized access if share is provided as argument.
+	// Tickets always include one.
+	pointer := BackupPointer{
+		Version:    EnvelopeVersion,
+		BaseCID:    encryptCID,
+		Name:       manifest.Name,
+		ID:         manifest.ID,
+		Bucket:     storjConfig.Bucket,
+		UploadPath: storjConfig.UploadPath,
+		FileName:   lastFileName,
+		DataKey:    dataKey,
+		Signature:  envelope.Signature,
+	}
+	if catalog != nil {
+		history.Record(NewSnapshot(storjConfig, manifest, configHash, dataKey, envelope.Signature))
+		catalog.Save(history)
+		if incremental {
+			fmt.Fprintf(statusOut, "Reused %d of %d chunks\n", result.Reused, result.Chunks)
+		}
+		fmt.Fprintf(statusOut, "Recorded as version %d of %s\n", len(history.Snapshots), sourceName)
+	}
 
-	var metaFile *os.File
-	metaFileName := "./metadata.txt"
-	os.Remove(metaFileName)
+	if useAccessShare || createTicket {
+		prefixes := manifest.ReferencedPrefixes()
+		if storjConfig.Private {
+			prefixes = append(prefixes, PrivateEnvelopeKey(storjConfig, configHash))
+		}
+		result.SharedAccess = ShareAccess(access, storjConfig, pointer, prefixes)
+		result.ShareID = ShareFingerprint(result.SharedAccess)
+	}
+	if createTicket {
+		result.Ticket = CreateTicket(configHash, result.SharedAccess, pointer, ticketPassphrase)
+	}
 
-	for i := 0; i < noOfChunkFiles; i++ {
+	result.DurationSeconds = time.Since(start).Seconds()
+	PrintResult(result)
+}
 
-		// Get the chunks data from the chunks DAG.
-		storeChunkFile, _ := chunkFile.NextBytes()
+// StoreKeys returns the recipients the data keys of new backups are encrypted to
+// and, when one is configured, the key they are signed with.
+func StoreKeys(storjConfig ConfigStorj) ([]Recipient, *SigningKey) {
 
-		//Encrypt the chunk data by the given key
-		key := []byte("This is a storj ipfs private key")
+	recipients, err := ParseRecipients(storjConfig.Recipients)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		encryptData, err := encrypt(key, storeChunkFile)
+	var signingKey *SigningKey
+	if storjConfig.SigningKey != "" {
+		parsed, err := ParseSigningKey(storjConfig.SigningKey)
 		if err != nil {
 			log.Fatal(err)
 		}
+		signingKey = &parsed
+	}
+	return recipients, signingKey
+}
 
-		// Create chunk CID using bytes data
-		encryptChunkCID := CreateCID(ipfsShell, encryptData)
-
-		fileName := encryptCID + "/" + encryptChunkCID
-
-		reader := bytes.NewReader(encryptData)
+// PublishBackup completes a backup whose chunks were stored: it uploads the manifest, seals the
+// storj location in an envelope, wraps the data key under the user's key and encrypts it to the
+// recipients, signs it, keeps a copy in the bucket and publishes it to IPFS.
+// It returns the envelope and its shareable hash.
+func PublishBackup(project *uplink.Project, ipfsShell *shell.Shell, storjConfig ConfigStorj, recipients []Recipient,
+	signingKey *SigningKey, dataKey []byte, manifest Manifest) (Envelope, string) {
 
-		// Upload chunk data on storj Network with baseCID/chunkCID name.
-		UploadData(project, storjConfig, fileName, reader)
+	// Store the manifest on storj network with baseCID/backupID.manifest
+	manifestDigest := UploadManifest(project, storjConfig, dataKey, manifest)
 
-		// Write all chunks CID into loacl disk file in append mode.
-		metaFile, _ = os.OpenFile(metaFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if _, err := metaFile.WriteString(encryptChunkCID + ","); err != nil {
-			log.Fatal(err)
-		}
+	fmt.Fprintln(statusOut, "\nAdding configuration data to IPFS: Initiated...")
 
-		// Close meta file after write all chunks into the file
-		err = metaFile.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
+	// Envelopes are named like the objects of the backup, the base CID is then only in the location.
+	location := BackupLocation{
+		Bucket:     storjConfig.Bucket,
+		UploadPath: storjConfig.UploadPath,
+		FileName:   manifest.FileName,
 	}
-
-	// Open meta file from local disk
-	openMetaFile, _ := os.Open(metaFileName)
-	metaBytes, err := ioutil.ReadAll(openMetaFile)
-	if err != nil {
-		log.Fatal("Reader Error:", err)
+	if manifest.Name != "" {
+		location.BaseCID = manifest.BaseCID
+		location.Name = manifest.Name
 	}
-	metaReader := bytes.NewReader(metaBytes)
-	// Close Meta file
-	openMetaFile.Close()
-	// Remove meta file from local disk.
-	err = os.Remove(metaFileName)
+	envelope, err := NewEnvelope(storjConfig.Key, recipients, dataKey, manifest.ObjectName(), location)
 	if err != nil {
 		log.Fatal(err)
 	}
+	envelope.ID = manifest.ID
+	if signingKey != nil {
+		envelope.Signature = signingKey.SignManifest(manifest.BaseCID, manifestDigest)
+		fmt.Fprintln(statusOut, "Signed by:", signingKey.PublicKey())
+	}
 
-	metaFileStoreName := encryptCID + "/" + encryptCID + ".txt"
+	envelope.Private = storjConfig.Private
+	configHash := SaveEnvelope(project, ipfsShell, storjConfig, envelope)
+	fmt.Fprintln(statusOut, "Shareable Hash:", configHash)
+	return envelope, configHash
+}
 
-	// Store meta file data on storj network with baseCID/baseCID.txt
-	UploadData(project, storjConfig, metaFileStoreName, metaReader)
+// storeUnchanged completes an incremental store whose input is identical to an earlier snapshot:
+// nothing is uploaded, the result is that backup, and it becomes the latest snapshot again.
+func storeUnchanged(access *uplink.Access, project *uplink.Project, storjConfig ConfigStorj, catalog *Catalog, history SourceHistory,
+	snapshot Snapshot, manifest Manifest, useAccessShare bool, createTicket bool, ticketPassphrase string, start time.Time) {
+
+	fmt.Fprintf(statusOut, "\n%s is unchanged since backup %s of %s\n", manifest.Source, snapshot.BaseCID, snapshot.Created.Format("2006-01-02 15:04:05"))
+	if latest := history.Latest(); latest.BaseCID != snapshot.BaseCID {
+		restored := snapshot
+		restored.Created = time.Now()
+		history.Record(restored)
+		catalog.Save(history)
+		fmt.Fprintf(statusOut, "Recorded as version %d of %s\n", len(history.Snapshots), manifest.Source)
+	}
+	fmt.Fprintln(statusOut, "Shareable Hash:", snapshot.Hash)
+
+	pointer := snapshot.Pointer(storjConfig.Bucket)
+	result := StoreResult{
+		BaseCID:     snapshot.BaseCID,
+		PointerHash: snapshot.Hash,
+		Bucket:      storjConfig.Bucket,
+		Prefix:      pointer.Prefix(),
+		FileName:    snapshot.FileName,
+		Bytes:       snapshot.Size,
+		Chunks:      snapshot.Chunks,
+		Reused:      snapshot.Chunks,
+		Unchanged:   true,
+	}
+	if snapshot.Signature != nil {
+		result.Signer = FormatSigner(snapshot.Signature.PublicKey)
+	}
+	if useAccessShare || createTicket {
+		result.SharedAccess = ShareAccess(access, storjConfig, pointer, ReadManifest(project, pointer).ReferencedPrefixes())
+		result.ShareID = ShareFingerprint(result.SharedAccess)
+	}
+	if createTicket {
+		result.Ticket = CreateTicket(snapshot.Hash, result.SharedAccess, pointer, ticketPassphrase)
+	}
+
+	result.DurationSeconds = time.Since(start).Seconds()
+	PrintResult(result)
+}
 
-	fmt.Println("\nAdding configuration data to IPFS: Initiated...")
+// StoreOptions configures StoreData.
+type StoreOptions struct {
+	ChunkSize int64
+	// Add are the parameters of ipfs add the base CID is computed with.
+	Add AddParams
+	// Size of the input, only used for progress reporting; zero when unknown.
+	Size int64
+	// DataKey encrypts the chunks.
+	DataKey []byte
+	// Reusable are the stored chunks, by content digest, that are referenced instead of uploaded again.
+	Reusable map[string]ManifestChunk
+	// Namer names the objects of the backup.
+	Namer ObjectNamer
+	// Progress is called while storing, it may be nil.
+	Progress ProgressFunc
+}
 
-	ipfsStorjData := storjConfig.Bucket + "," + storjConfig.UploadPath + "," + lastFileName
+// StoreData chunks, encrypts and uploads data read from reader in a single pass,
+// until io.EOF and without knowing its size up front. Every chunk is uploaded as soon
+// as it is read, below the random ID of the backup, while the input is teed into the
+// base CID computation; the base CID is only recorded in the manifest.
+// It returns the manifest of the uploaded chunks.
+func StoreData(ipfsShell *shell.Shell, project *uplink.Project, storjConfig ConfigStorj, reader io.Reader, options StoreOptions) Manifest {
+
+	// Compute the base CID from everything the chunker reads.
+	pipeReader, pipeWriter := io.Pipe()
+	cidResult := make(chan string, 1)
+	go func() {
+		encryptCID, err := ipfsShell.Add(pipeReader, append(options.Add.Options(), shell.OnlyHash(true))...)
+		if err != nil {
+			_ = pipeReader.CloseWithError(err)
+		}
+		// Drain whatever the daemon did not consume so the writer never blocks.
+		_, _ = io.Copy(ioutil.Discard, pipeReader)
+		cidResult <- encryptCID
+	}()
+
+	var chunksTotal int
+	if options.Size > 0 {
+		chunksTotal = int((options.Size + options.ChunkSize - 1) / options.ChunkSize)
+	}
+	storeTracker := NewProgressTracker("store", options.Size, chunksTotal, options.Progress)
 
-	//Encrypt the storj configration data
-	enkey := []byte(storjConfig.Key)
+	chunkFile := chunker.NewSizeSplitter(io.TeeReader(storeTracker.Reader(reader), pipeWriter), options.ChunkSize)
 
-	ipfsStorjDataBytes := []byte(ipfsStorjData)
-	storjEncryptData, err := encrypt(enkey, ipfsStorjDataBytes)
+	// The objects of the backup are named after its ID, which is known before any data is.
+	id, err := NewBackupID()
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal("Could not generate backup ID: ", err)
 	}
+	manifest := Manifest{Version: EnvelopeVersion, ID: id, Name: id, Add: &options.Add}
+	fmt.Fprintf(statusOut, "\nUploading chunks to %s in %s\n", storjConfig.UploadPath+manifest.ObjectName()+"/", storjConfig.Bucket)
+	for {
+		// Get the next chunk as soon as enough data arrived.
+		storeChunkFile, err := chunkFile.NextBytes()
+		if err == io.EOF {
+			// Empty input is stored as a single empty chunk.
+			if len(manifest.Chunks) > 0 {
+				break
+			}
+			storeChunkFile = []byte{}
+		} else if err != nil {
+			log.Fatal("Could not read input: ", err)
+		}
 
-	hash := []byte(encryptCID)
+		// Unchanged chunks are taken over from the earlier backup, with their object and data key.
+		plainDigest := sha256.Sum256(storeChunkFile)
+		if reused, ok := options.Reusable[hex.EncodeToString(plainDigest[:])]; ok && reused.Size == int64(len(storeChunkFile)) {
+			manifest.Chunks = append(manifest.Chunks, reused)
+			manifest.Size += reused.Size
+			storeTracker.ChunkDone()
+			continue
+		}
 
-	// Create buffer for Chunk CID and encrypted Storj configurations.
-	encryptedStorjConfig := append(hash, storjEncryptData...)
+		encryptData, err := SealData(options.DataKey, storeChunkFile)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	// Create the CID from encrypted chunk data and encrypted
-	// storj configration and enrypted private key.
-	configHash, _ := ipfsShell.Add(bytes.NewReader(encryptedStorjConfig))
-	fmt.Println("Shareable Hash:", configHash)
+		// Create chunk CID using bytes data and upload the chunk on storj Network with backupID/chunkCID name.
+		encryptChunkCID := CreateCID(ipfsShell, encryptData)
+		manifestChunk := ManifestChunk{CID: encryptChunkCID, Size: int64(len(storeChunkFile)), PlainSHA256: plainDigest[:]}
+		objectName := encryptChunkCID
+		if options.Namer.Obfuscated() {
+			manifestChunk.Name = options.Namer.Name(encryptChunkCID)
+			objectName = manifestChunk.Name
+		}
+		uploadObject(project, storjConfig, manifest.ObjectName()+"/"+objectName, bytes.NewReader(encryptData))
 
-	// Create restricted shareable serialized access if share is provided as argument.
-	if useAccessShare {
-		ShareAccess(access, storjConfig)
+		chunkDigest := sha256.Sum256(encryptData)
+		manifestChunk.SHA256 = chunkDigest[:]
+		manifest.Chunks = append(manifest.Chunks, manifestChunk)
+		manifest.Size += int64(len(storeChunkFile))
+		storeTracker.ChunkDone()
 	}
+	storeTracker.Finish()
 
+	if err = pipeWriter.Close(); err != nil {
+		log.Fatal(err)
+	}
+	manifest.BaseCID = <-cidResult
+	if manifest.BaseCID == "" {
+		log.Fatal("Could not compute the base CID of the input")
+	}
+	return manifest
 }
 
 func storjDownload(cmd *cobra.Command, args []string) {
@@ -201,6 +569,87 @@ func storjDownload(cmd *cobra.Command, args []string) {
 	fullFileNameDownload, _ := cmd.Flags().GetString("storjDown")
 	useAccessKey, _ := cmd.Flags().GetBool("accesskey")
 	fullFileNameStorj, _ := cmd.Flags().GetString("storj")
+	destPath, _ := cmd.Flags().GetString("dest")
+	overwritePolicy, _ := cmd.Flags().GetString("overwrite")
+	strict, _ := cmd.Flags().GetBool("strict")
+	keyShares, _ := cmd.Flags().GetStringSlice("key-share")
+	keySharesFile, _ := cmd.Flags().GetString("key-shares-file")
+	ticketText, _ := cmd.Flags().GetString("ticket")
+	ticketFile, _ := cmd.Flags().GetString("ticket-file")
+	sourceName, _ := cmd.Flags().GetString("source")
+	at, _ := cmd.Flags().GetString("at")
+	version, _ := cmd.Flags().GetInt("version")
+	mfsPath, _ := cmd.Flags().GetString("mfs")
+	importDAG, _ := cmd.Flags().GetBool("import")
+	addToIPFS, _ := cmd.Flags().GetBool("add")
+	carVersion, _ := cmd.Flags().GetInt("car-version")
+	ipnsName, _ := cmd.Flags().GetString("ipns")
+	indexName, _ := cmd.Flags().GetString("index-name")
+
+	if carVersion != 0 && carVersion != 1 && carVersion != 2 {
+		log.Fatalf("Unsupported CAR version %d, use 1 or 2", carVersion)
+	}
+	if err := ValidateOverwritePolicy(overwritePolicy); err != nil {
+		log.Fatal(err)
+	}
+	if sourceName == "" && (at != "" || version != 0) {
+		log.Fatal("--at and --version select a version of the source given with --source")
+	}
+	if at != "" && version != 0 {
+		log.Fatal("Select the version of the source either with --at or with --version")
+	}
+	if ipnsName != "" && (at != "" || version != 0) {
+		log.Fatal("A backup index only lists the latest backup of each source, --at and --version select versions in the catalog")
+	}
+	if ipnsName != "" && sourceName != "" {
+		log.Fatal("With --ipns select the backup with --index-name, --source selects a source of the catalog")
+	}
+	if indexName != "" && ipnsName == "" {
+		log.Fatal("--index-name selects a backup in the index given with --ipns")
+	}
+
+	// Keep stdout free for the restored data when streaming to it.
+	if destPath == StdoutDestination {
+		streamToStdout()
+	}
+
+	// A ticket carries everything needed, no configuration file is read.
+	if ticketText != "" || ticketFile != "" {
+		downloadConfig := DownloadConfigStorj{DownloadPath: ".", Overwrite: overwritePolicy, Strict: strict}
+		// The download configuration is only used when given explicitly, e.g. for its trusted keys.
+		if cmd.Flags().Changed("storjDown") {
+			downloadConfig = LoadStorjDownloadConfiguration(fullFileNameDownload)
+			if overwritePolicy != "" {
+				downloadConfig.Overwrite = overwritePolicy
+			}
+			if strict {
+				downloadConfig.Strict = true
+			}
+		}
+		if destPath != "" {
+			downloadConfig.DownloadPath = destPath
+		}
+		if downloadConfig.DownloadPath == StdoutDestination {
+			streamToStdout()
+		}
+		if mfsPath != "" {
+			downloadConfig.MFSPath = mfsPath
+		}
+		if importDAG {
+			downloadConfig.ImportDAG = true
+		}
+		if addToIPFS {
+			downloadConfig.AddToIPFS = true
+		}
+		if carVersion != 0 {
+			downloadConfig.CARVersion = carVersion
+		}
+		if downloadConfig.NeedsIPFS() {
+			downloadConfig.IPFS = ConnectToIpfs(LoadIpfsProperty(ipfsConfigfilePath))
+		}
+		PrintResult(DownloadTicket(ticketText, ticketFile, downloadConfig, progressPrinter(cmd)))
+		return
+	}
 
 	// Read storj network configurations from and external file and create a storj configuration object.
 	storjConfig := LoadStorjConfiguration(fullFileNameStorj)
@@ -210,32 +659,73 @@ func storjDownload(cmd *cobra.Command, args []string) {
 
 	// Connect to storj network using the specified credentials.
 	_, project := ConnectToStorj(fullFileNameStorj, storjConfig, useAccessKey)
+	defer func() {
+		_ = project.Close()
+	}()
 
 	// Read storj network cofiguration related to download.
 	downloadConfig := LoadStorjDownloadConfiguration(fullFileNameDownload)
+	if len(keyShares) > 0 || keySharesFile != "" {
+		downloadConfig.Key = KeyFromShares(keyShares, keySharesFile)
+	}
+	// The catalog of sources is only encrypted with the key.
+	if downloadConfig.Credentials().Empty() || (sourceName != "" && downloadConfig.Key == "") {
+		downloadConfig.Key = PromptKey(false)
+	}
 
-	// Connect to ipfs network using specified credentials.
-	ipfsDownloadShell := ConnectToIpfs(configIpfs)
-
-	reader := GetReaderDownload(ipfsDownloadShell, downloadConfig.Hash)
+	// Flags take precedence over the download configuration.
+	if destPath != "" {
+		downloadConfig.DownloadPath = destPath
+	}
+	if downloadConfig.DownloadPath == StdoutDestination {
+		streamToStdout()
+	}
+	if overwritePolicy != "" {
+		downloadConfig.Overwrite = overwritePolicy
+	}
+	if strict {
+		downloadConfig.Strict = true
+	}
+	if mfsPath != "" {
+		downloadConfig.MFSPath = mfsPath
+	}
+	if importDAG {
+		downloadConfig.ImportDAG = true
+	}
+	if addToIPFS {
+		downloadConfig.AddToIPFS = true
+	}
+	if carVersion != 0 {
+		downloadConfig.CARVersion = carVersion
+	}
 
-	DownloadData(project, downloadConfig, reader)
+	// Versions of a source are found in the catalog, IPFS is only needed to restore into it.
+	if sourceName != "" {
+		if downloadConfig.NeedsIPFS() {
+			downloadConfig.IPFS = ConnectToIpfs(configIpfs)
+		}
+		PrintResult(DownloadSnapshot(project, storjConfig, downloadConfig, sourceName, version, at, progressPrinter(cmd)))
+		return
+	}
 
-}
+	// The envelopes of private backups are found in the bucket, IPFS is then only needed to restore into it.
+	var reader *bytes.Reader
+	private := false
+	if ipnsName == "" {
+		reader, private = ReadPrivateEnvelope(project, storjConfig, downloadConfig.Hash)
+	}
+	if !private || downloadConfig.NeedsIPFS() {
+		// Connect to ipfs network using specified credentials.
+		downloadConfig.IPFS = ConnectToIpfs(configIpfs)
+	}
 
-// Encrypt Function to encrypt data with specified key
-func encrypt(key, text []byte) ([]byte, error) {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
+	if ipnsName != "" {
+		downloadConfig.Hash = ResolveIndexHash(downloadConfig.IPFS, ipnsName, indexName, downloadConfig.TrustPolicy())
 	}
-	b := base64.StdEncoding.EncodeToString(text)
-	ciphertext := make([]byte, aes.BlockSize+len(b))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		return nil, err
+	if !private {
+		reader = GetReaderDownload(downloadConfig.IPFS, downloadConfig.Hash)
 	}
-	cfb := cipher.NewCFBEncrypter(block, iv)
-	cfb.XORKeyStream(ciphertext[aes.BlockSize:], []byte(b))
-	return ciphertext, nil
+
+	PrintResult(DownloadData(project, downloadConfig, reader, progressPrinter(cmd)))
+
 }
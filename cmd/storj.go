@@ -17,8 +17,11 @@ import (
 
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 
+	shell "github.com/ipfs/go-ipfs-api"
 	"storj.io/uplink"
 )
 
@@ -32,11 +35,35 @@ type ConfigStorj struct {
 	EncryptionPassphrase string `json:"encryptionpassphrase"`
 	SerializedAccess     string `json:"serializedAccess"`
 	AllowDownload        string `json:"allowDownload"`
-	AllowUpload          string `json:"allowUpload"`
-	AllowList            string `json:"allowList"`
-	AllowDelete          string `json:"allowDelete"`
 	NotBefore            string `json:"notBefore"`
 	NotAfter             string `json:"notAfter"`
+
+	// ShareAllow are the operations besides download shared accesses allow, given with --allow.
+	ShareAllow []string `json:"-"`
+
+	// Recipients are the X25519 public keys the data key of new backups is encrypted to.
+	Recipients []string `json:"recipients"`
+
+	// SigningKey is the Ed25519 key new backups are signed with, if set.
+	SigningKey string `json:"signingKey"`
+
+	// Private keeps the envelopes of new backups out of IPFS, see SaveEnvelope.
+	Private bool `json:"private"`
+
+	// KeyLayout names the objects of new backups, see ObjectNamer.
+	KeyLayout string `json:"keyLayout"`
+
+	// Alternative sources of the secrets above, see SecretSource.
+	KeyFile                     string `json:"keyFile"`
+	KeyCommand                  string `json:"keyCommand"`
+	APIKeyFile                  string `json:"apikeyFile"`
+	APIKeyCommand               string `json:"apikeyCommand"`
+	EncryptionPassphraseFile    string `json:"encryptionpassphraseFile"`
+	EncryptionPassphraseCommand string `json:"encryptionpassphraseCommand"`
+	SerializedAccessFile        string `json:"serializedAccessFile"`
+	SerializedAccessCommand     string `json:"serializedAccessCommand"`
+	SigningKeyFile              string `json:"signingKeyFile"`
+	SigningKeyCommand           string `json:"signingKeyCommand"`
 }
 
 // DownloadConfigStorj structure to store data from json file
@@ -44,6 +71,62 @@ type DownloadConfigStorj struct {
 	Hash         string `json:"hash"`
 	DownloadPath string `json:"downloadPath"`
 	Key          string `json:"key"`
+	Overwrite    string `json:"overwrite"`
+
+	// KeyShares restore the key when it is not at hand, see key split.
+	KeyShares     []string `json:"keyShares"`
+	KeySharesFile string   `json:"keySharesFile"`
+
+	// Identity holds X25519 identities, one per line, used instead of the key
+	// for backups encrypted to recipients.
+	Identity string `json:"identity"`
+
+	// TrustedKeys are the Ed25519 public keys of trusted signers.
+	// In strict mode backups not signed by one of them are refused.
+	TrustedKeys []string `json:"trustedKeys"`
+	Strict      bool     `json:"strict"`
+
+	// Alternative sources of the key and identity, see SecretSource.
+	KeyFile         string `json:"keyFile"`
+	KeyCommand      string `json:"keyCommand"`
+	IdentityFile    string `json:"identityFile"`
+	IdentityCommand string `json:"identityCommand"`
+
+	// MFSPath is the MFS directory backups of MFS are rebuilt in, instead of a local directory.
+	MFSPath string `json:"mfsPath"`
+
+	// ImportDAG imports backups of DAGs into the IPFS node instead of writing them as CAR files,
+	// CARVersion selects the version of those files, 1 (the default) or 2.
+	ImportDAG  bool `json:"importDAG"`
+	CARVersion int  `json:"carVersion"`
+
+	// AddToIPFS adds restored files to the IPFS node as well, with the parameters their base CID was computed with.
+	AddToIPFS bool `json:"addToIPFS"`
+
+	// Identities are parsed from the identity sources.
+	Identities []*Identity `json:"-"`
+
+	// IPFS is the node backups of MFS are rebuilt on, backups of DAGs imported into and files added to.
+	IPFS *shell.Shell `json:"-"`
+}
+
+// NeedsIPFS reports whether restores are written into the IPFS node, which downloads by hash always connect to.
+func (downloadConfigStorj DownloadConfigStorj) NeedsIPFS() bool {
+	return downloadConfigStorj.MFSPath != "" || downloadConfigStorj.ImportDAG || downloadConfigStorj.AddToIPFS
+}
+
+// TrustPolicy returns the policy signatures of restored backups are checked with.
+func (downloadConfigStorj DownloadConfigStorj) TrustPolicy() TrustPolicy {
+	trustedKeys, err := ParseTrustedKeys(downloadConfigStorj.TrustedKeys)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return TrustPolicy{TrustedKeys: trustedKeys, Strict: downloadConfigStorj.Strict}
+}
+
+// Credentials returns the secrets backups can be restored with.
+func (downloadConfigStorj DownloadConfigStorj) Credentials() Credentials {
+	return Credentials{Key: downloadConfigStorj.Key, Identities: downloadConfigStorj.Identities}
 }
 
 // LoadStorjConfiguration reads and parses the JSON file that contain Storj configuration information.
@@ -55,8 +138,12 @@ func LoadStorjConfiguration(fullFileName string) ConfigStorj {
 		log.Fatal("Could not load storj config file: ", err)
 	}
 
+	var data json.RawMessage
 	jsonParser := json.NewDecoder(fileHandle)
-	if err = jsonParser.Decode(&configStorj); err != nil {
+	if err = jsonParser.Decode(&data); err != nil {
+		log.Fatal(err)
+	}
+	if err = json.Unmarshal(data, &configStorj); err != nil {
 		log.Fatal(err)
 	}
 
@@ -65,11 +152,21 @@ func LoadStorjConfiguration(fullFileName string) ConfigStorj {
 		log.Fatal(err)
 	}
 
-	// Display storj configuration read from file.
-	fmt.Println("\nRead Storj configuration from the ", fullFileName, " file")
-	fmt.Println("API Key\t\t: ", configStorj.APIKey)
-	fmt.Println("Satellite	: ", configStorj.Satellite)
-	fmt.Println("Bucket		: ", configStorj.Bucket)
+	// Read the secrets from the environment, secret files or commands if configured.
+	configStorj.Key = loadSecret(SecretSource{Name: "key", Env: EnvKey, File: configStorj.KeyFile, Command: configStorj.KeyCommand, Inline: configStorj.Key})
+	configStorj.APIKey = loadSecret(SecretSource{Name: "apikey", Env: EnvAPIKey, File: configStorj.APIKeyFile, Command: configStorj.APIKeyCommand, Inline: configStorj.APIKey})
+	configStorj.EncryptionPassphrase = loadSecret(SecretSource{Name: "encryptionpassphrase", Env: EnvEncryptionPassphrase, File: configStorj.EncryptionPassphraseFile, Command: configStorj.EncryptionPassphraseCommand, Inline: configStorj.EncryptionPassphrase})
+	configStorj.SerializedAccess = loadSecret(SecretSource{Name: "serializedAccess", Env: EnvSerializedAccess, File: configStorj.SerializedAccessFile, Command: configStorj.SerializedAccessCommand, Inline: configStorj.SerializedAccess})
+	configStorj.SigningKey = loadSecret(SecretSource{Name: "signingKey", Env: EnvSigningKey, File: configStorj.SigningKeyFile, Command: configStorj.SigningKeyCommand, Inline: configStorj.SigningKey})
+
+	// Display storj configuration read from file, secrets are masked.
+	fmt.Fprintln(statusOut, "\nRead Storj configuration from the ", fullFileName, " file")
+	for _, setting := range removedShareSettings(data) {
+		fmt.Fprintf(statusOut, "Ignoring %s: it is no longer supported, shared accesses are download-only unless --allow is given\n", setting)
+	}
+	fmt.Fprintln(statusOut, "API Key\t\t: ", MaskSecret(configStorj.APIKey))
+	fmt.Fprintln(statusOut, "Satellite	: ", configStorj.Satellite)
+	fmt.Fprintln(statusOut, "Bucket		: ", configStorj.Bucket)
 
 	// Convert the upload path to standard form.
 	checkSlash := configStorj.UploadPath[len(configStorj.UploadPath)-1:]
@@ -77,11 +174,45 @@ func LoadStorjConfiguration(fullFileName string) ConfigStorj {
 		configStorj.UploadPath = configStorj.UploadPath + "/"
 	}
 
-	fmt.Println("Upload Path\t: ", configStorj.UploadPath)
-	fmt.Println("Serialized Access Key\t: ", configStorj.SerializedAccess)
+	fmt.Fprintln(statusOut, "Upload Path\t: ", configStorj.UploadPath)
+	fmt.Fprintln(statusOut, "Serialized Access Key\t: ", MaskSecret(configStorj.SerializedAccess))
+	if len(configStorj.Recipients) > 0 {
+		fmt.Fprintln(statusOut, "Recipients\t: ", len(configStorj.Recipients))
+	}
+	if configStorj.SigningKey != "" {
+		fmt.Fprintln(statusOut, "Signing Key\t: ", MaskSecret(configStorj.SigningKey))
+	}
 	return configStorj
 }
 
+// removedShareSettings returns the settings of a storj configuration that used to grant operations
+// to shared accesses. Shipped configurations allowed all of them, --allow replaces them.
+func removedShareSettings(data []byte) []string {
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil
+	}
+	var removed []string
+	for _, setting := range []string{"allowUpload", "allowList", "allowDelete"} {
+		if _, ok := settings[setting]; ok {
+			removed = append(removed, setting)
+		}
+	}
+	return removed
+}
+
+// loadSecret resolves a secret and exits when its source can not be read.
+func loadSecret(source SecretSource) string {
+	secret, origin, err := source.Resolve()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if origin != "" && origin != "configuration" {
+		fmt.Fprintf(statusOut, "Read %s from %s\n", source.Name, origin)
+	}
+	return secret
+}
+
 // LoadStorjDownloadConfiguration reads and parses the JSON file that contain Storj configuration information.
 func LoadStorjDownloadConfiguration(fullFileName string) DownloadConfigStorj { // fullFileName for fetching storj V3 credentials from  given JSON filename.
 
@@ -103,26 +234,70 @@ func LoadStorjDownloadConfiguration(fullFileName string) DownloadConfigStorj { /
 		log.Fatal(err)
 	}
 
+	// Read the key from the environment, a secret file or a command if configured.
+	downloadConfigStorj.Key = loadSecret(SecretSource{Name: "key", Env: EnvKey, File: downloadConfigStorj.KeyFile, Command: downloadConfigStorj.KeyCommand, Inline: downloadConfigStorj.Key})
+	if len(downloadConfigStorj.KeyShares) > 0 || downloadConfigStorj.KeySharesFile != "" {
+		downloadConfigStorj.Key = KeyFromShares(downloadConfigStorj.KeyShares, downloadConfigStorj.KeySharesFile)
+	}
+	downloadConfigStorj.Identities = LoadIdentities(SecretSource{Name: "identity", Env: EnvIdentity, File: downloadConfigStorj.IdentityFile, Command: downloadConfigStorj.IdentityCommand, Inline: downloadConfigStorj.Identity})
+
 	// Display read information.
-	fmt.Println("\nReading Download configuration from file: ", fullFileName)
-	fmt.Println("Hash\t\t\t: ", downloadConfigStorj.Hash)
-	fmt.Println("Download Path\t\t: ", downloadConfigStorj.DownloadPath)
+	fmt.Fprintln(statusOut, "\nReading Download configuration from file: ", fullFileName)
+	fmt.Fprintln(statusOut, "Hash\t\t\t: ", downloadConfigStorj.Hash)
+	fmt.Fprintln(statusOut, "Download Path\t\t: ", downloadConfigStorj.DownloadPath)
+	if downloadConfigStorj.Overwrite != "" {
+		fmt.Fprintln(statusOut, "Overwrite\t\t: ", downloadConfigStorj.Overwrite)
+	}
+	if err = ValidateOverwritePolicy(downloadConfigStorj.Overwrite); err != nil {
+		log.Fatal(err)
+	}
+	if len(downloadConfigStorj.TrustedKeys) > 0 || downloadConfigStorj.Strict {
+		fmt.Fprintln(statusOut, "Trusted Keys\t\t: ", len(downloadConfigStorj.TrustedKeys))
+		fmt.Fprintln(statusOut, "Strict\t\t\t: ", downloadConfigStorj.Strict)
+	}
 
 	return downloadConfigStorj
 }
 
-// ShareAccess generates and prints the shareable serialized access
-// as per the restrictions provided by the user.
-func ShareAccess(access *uplink.Access, configStorj ConfigStorj) {
+// SharePermission returns the permission of shared accesses as requested by the user.
+// Shares are download-only unless other operations are asked for with --allow.
+func SharePermission(configStorj ConfigStorj) uplink.Permission {
 
-	allowDownload, _ := strconv.ParseBool(configStorj.AllowDownload)
-	allowUpload, _ := strconv.ParseBool(configStorj.AllowUpload)
-	allowList, _ := strconv.ParseBool(configStorj.AllowList)
-	allowDelete, _ := strconv.ParseBool(configStorj.AllowDelete)
-	notBefore, _ := time.Parse("2006-01-02_15:04:05", configStorj.NotBefore)
-	notAfter, _ := time.Parse("2006-01-02_15:04:05", configStorj.NotAfter)
+	allowDownload := true
+	if configStorj.AllowDownload != "" {
+		allowDownload, _ = strconv.ParseBool(configStorj.AllowDownload)
+	}
+	var allowUpload, allowList, allowDelete bool
+	for _, operation := range configStorj.ShareAllow {
+		switch strings.TrimSpace(operation) {
+		case "upload":
+			allowUpload = true
+		case "list":
+			allowList = true
+		case "delete":
+			allowDelete = true
+		default:
+			log.Fatalf("Unknown operation %q to allow, expected upload, list or delete", operation)
+		}
+	}
+	// Relative times of both ends are counted from the same instant.
+	now := time.Now()
+	notBefore, err := ParseShareTime(configStorj.NotBefore, now)
+	if err != nil {
+		log.Fatal("Invalid notBefore: ", err)
+	}
+	notAfter, err := ParseShareTime(configStorj.NotAfter, now)
+	if err != nil {
+		log.Fatal("Invalid notAfter: ", err)
+	}
+	if !notBefore.IsZero() && !notAfter.IsZero() && !notBefore.Before(notAfter) {
+		log.Fatalf("notBefore (%s) must be before notAfter (%s)", notBefore.Format(time.RFC3339), notAfter.Format(time.RFC3339))
+	}
+	if !notAfter.IsZero() && !notAfter.After(now) {
+		log.Fatalf("notAfter (%s) is in the past, the shared access would never be valid", notAfter.Format(time.RFC3339))
+	}
 
-	permission := uplink.Permission{
+	return uplink.Permission{
 		AllowDownload: allowDownload,
 		AllowUpload:   allowUpload,
 		AllowList:     allowList,
@@ -130,9 +305,35 @@ func ShareAccess(access *uplink.Access, configStorj ConfigStorj) {
 		NotBefore:     notBefore,
 		NotAfter:      notAfter,
 	}
+}
+
+// SharePrefixes returns the prefixes a shared access to the backup covers: its own prefix and
+// the referenced ones, which may be object keys, see PrivateEnvelopeKey.
+func SharePrefixes(pointer BackupPointer, referencedPrefixes []string) []uplink.SharePrefix {
+	prefix := pointer.Prefix()
+	sharePrefixes := []uplink.SharePrefix{{Bucket: pointer.Bucket, Prefix: prefix}}
+	for _, referenced := range referencedPrefixes {
+		if referenced == prefix {
+			continue
+		}
+		sharePrefixes = append(sharePrefixes, uplink.SharePrefix{Bucket: pointer.Bucket, Prefix: referenced})
+	}
+	return sharePrefixes
+}
+
+// ShareAccess generates and prints the shareable serialized access
+// as per the restrictions provided by the user and returns it.
+// The access is restricted to the prefix of the backup and to the other prefixes it is restored from.
+// Those are earlier backups it reuses chunks from, and the envelope of a private backup.
+// Every access is recorded in the share registry, so that it can be revoked later.
+func ShareAccess(access *uplink.Access, configStorj ConfigStorj, pointer BackupPointer, referencedPrefixes []string) string {
+
+	permission := SharePermission(configStorj)
+	bucket, prefix := pointer.Bucket, pointer.Prefix()
+	sharePrefixes := SharePrefixes(pointer, referencedPrefixes)
 
 	// Create shared access.
-	sharedAccess, err := access.Share(permission)
+	sharedAccess, err := access.Share(permission, sharePrefixes...)
 	if err != nil {
 		log.Fatal("Could not generate shared access: ", err)
 	}
@@ -142,12 +343,129 @@ func ShareAccess(access *uplink.Access, configStorj ConfigStorj) {
 	if err != nil {
 		log.Fatal("Could not serialize shared access: ", err)
 	}
-	fmt.Println("Shareable serialized access: ", serializedAccess)
+	fmt.Fprintf(statusOut, "Shared access to %s/%s (%s)\n", bucket, prefix, describePermission(permission))
+	if more := len(sharePrefixes) - 1; more > 0 {
+		fmt.Fprintf(statusOut, "and to %d more prefixes the backup is restored from\n", more)
+	}
+	fmt.Fprintln(statusOut, "Valid\t\t: ", describeWindow(permission.NotBefore, permission.NotAfter))
+	fmt.Fprintln(statusOut, "Shareable serialized access: ", serializedAccess)
+	RecordShare(pointer, permission, serializedAccess)
+	return serializedAccess
+}
+
+// shareTimeLayout is the layout times of shared accesses were configured in before RFC3339 was supported.
+const shareTimeLayout = "2006-01-02_15:04:05"
+
+// dayLayout is the layout of plain days, which mean the start of the day in local time.
+const dayLayout = "2006-01-02"
+
+// ParseShareTime parses the notBefore and notAfter times of shared accesses.
+// Empty and "0" mean no limit. Besides absolute RFC3339 timestamps (and the older
+// 2006-01-02_15:04:05 layout, in UTC) and days like 2006-01-02, durations relative
+// to now are accepted, e.g. +72h, 90m, 7d, 2w or 1d12h; a leading - counts back from now.
+func ParseShareTime(value string, now time.Time) (time.Time, error) {
+
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" {
+		return time.Time{}, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	if parsed, err := time.Parse(shareTimeLayout, value); err == nil {
+		return parsed, nil
+	}
+	if day, err := time.ParseInLocation(dayLayout, value, time.Local); err == nil {
+		return day, nil
+	}
+
+	duration, err := parseRelativeDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC3339 time like 2006-01-02T15:04:05Z, a day like 2006-01-02 nor a duration like +72h or 7d", value)
+	}
+	return now.Add(duration), nil
+}
+
+// parseRelativeDuration parses a duration that may start with a sign and a number of weeks or days.
+func parseRelativeDuration(value string) (time.Duration, error) {
+
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(value, "+"):
+		value = value[1:]
+	case strings.HasPrefix(value, "-"):
+		sign = -1
+		value = value[1:]
+	}
+	if value == "" {
+		return 0, errors.New("missing duration")
+	}
+
+	var duration time.Duration
+	for _, unit := range []struct {
+		suffix string
+		length time.Duration
+	}{{"w", 7 * 24 * time.Hour}, {"d", 24 * time.Hour}} {
+		index := strings.Index(value, unit.suffix)
+		if index < 0 {
+			continue
+		}
+		count, err := strconv.Atoi(value[:index])
+		if err != nil || count < 0 {
+			return 0, fmt.Errorf("invalid number of %s", unit.suffix)
+		}
+		duration += time.Duration(count) * unit.length
+		value = value[index+1:]
+	}
+
+	if value != "" {
+		rest, err := time.ParseDuration(value)
+		if err != nil || rest < 0 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		duration += rest
+	}
+	return sign * duration, nil
+}
+
+// describeWindow describes the time window a shared access is valid in.
+func describeWindow(notBefore time.Time, notAfter time.Time) string {
+	from := "now"
+	if !notBefore.IsZero() {
+		from = notBefore.Local().Format(time.RFC3339)
+	}
+	until := "no expiry"
+	if !notAfter.IsZero() {
+		until = notAfter.Local().Format(time.RFC3339)
+	}
+	return "from " + from + " until " + until
+}
+
+// describePermission lists the operations a permission allows.
+func describePermission(permission uplink.Permission) string {
+	var allowed []string
+	if permission.AllowDownload {
+		allowed = append(allowed, "download")
+	}
+	if permission.AllowUpload {
+		allowed = append(allowed, "upload")
+	}
+	if permission.AllowList {
+		allowed = append(allowed, "list")
+	}
+	if permission.AllowDelete {
+		allowed = append(allowed, "delete")
+	}
+	if len(allowed) == 0 {
+		return "no operations"
+	}
+	return strings.Join(allowed, ", ")
 }
 
 // ConnectToStorj reads Storj configuration from given file
 // and connects to the desired Storj network.
 // It then reads data property from an external file.
+// The caller closes the returned project.
 func ConnectToStorj(fullFileName string, configStorj ConfigStorj, accesskey bool) (*uplink.Access, *uplink.Project) {
 
 	var access *uplink.Access
@@ -159,14 +477,14 @@ func ConnectToStorj(fullFileName string, configStorj ConfigStorj, accesskey bool
 	var err error
 
 	if accesskey {
-		fmt.Println("\nConnecting to Storj network using Serialized access.")
+		fmt.Fprintln(statusOut, "\nConnecting to Storj network using Serialized access.")
 		// Generate access handle using serialized access.
 		access, err = uplink.ParseAccess(configStorj.SerializedAccess)
 		if err != nil {
 			log.Fatal(err)
 		}
 	} else {
-		fmt.Println("\nConnecting to Storj network.")
+		fmt.Fprintln(statusOut, "\nConnecting to Storj network.")
 		// Generate access handle using API key, satellite url and encryption passphrase.
 		access, err = cfg.RequestAccessWithPassphrase(ctx, configStorj.Satellite, configStorj.APIKey, configStorj.EncryptionPassphrase)
 		if err != nil {
@@ -179,12 +497,6 @@ func ConnectToStorj(fullFileName string, configStorj ConfigStorj, accesskey bool
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer func() {
-		err := project.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-	}()
 
 	// Ensure the desired Bucket within the Project.
 	_, err = project.EnsureBucket(ctx, configStorj.Bucket)
@@ -192,13 +504,39 @@ func ConnectToStorj(fullFileName string, configStorj ConfigStorj, accesskey bool
 		log.Fatal(err)
 	}
 
-	fmt.Println("Successfully connected to Storj network.")
+	fmt.Fprintln(statusOut, "Successfully connected to Storj network.")
 	return access, project
 }
 
+// OpenSharedProject opens the project of a serialized access shared for a single backup.
+// Unlike ConnectToStorj it does not touch the bucket, which such accesses are not allowed to.
+func OpenSharedProject(serializedAccess string) *uplink.Project {
+
+	access, err := uplink.ParseAccess(serializedAccess)
+	if err != nil {
+		log.Fatal("Invalid shared access: ", err)
+	}
+
+	fmt.Fprintln(statusOut, "\nConnecting to Storj network using shared access.")
+	project, err := uplink.Config{UserAgent: "IPFS"}.OpenProject(context.Background(), access)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintln(statusOut, "Successfully connected to Storj network.")
+	return project
+}
+
 // UploadData uploads the backup file to storj network.
 func UploadData(project *uplink.Project, configStorj ConfigStorj, uploadFileName string, reader io.Reader) {
 
+	fmt.Fprintf(statusOut, "\nUploading %s to %s.", configStorj.UploadPath+uploadFileName, configStorj.Bucket)
+	uploadObject(project, configStorj, uploadFileName, reader)
+	fmt.Fprintln(statusOut)
+}
+
+// uploadObject uploads the content of reader to the given object without printing status.
+func uploadObject(project *uplink.Project, configStorj ConfigStorj, uploadFileName string, reader io.Reader) {
+
 	ctx := context.Background()
 
 	// Create an upload handle.
@@ -206,7 +544,6 @@ func UploadData(project *uplink.Project, configStorj ConfigStorj, uploadFileName
 	if err != nil {
 		log.Fatal("Could not initiate upload : ", err)
 	}
-	fmt.Printf("\nUploading %s to %s.", configStorj.UploadPath+uploadFileName, configStorj.Bucket)
 
 	// Upload data on storj.
 	_, err = io.Copy(upload, reader)
@@ -215,37 +552,119 @@ func UploadData(project *uplink.Project, configStorj ConfigStorj, uploadFileName
 		log.Fatal("Could not upload data to storj: ", err, abortErr)
 	}
 	// Commit the upload after copying the complete content of the backup file to upload object.
-	fmt.Println("\nPlease wait while the upload is being committed to Storj.")
 	err = upload.Commit()
 	if err != nil {
 		log.Fatal("Could not commit object upload : ", err)
 	}
 }
 
-// DownloadData function downloads the data from storj bucket after upload to verify data is uploaded successfully.
-func DownloadData(project *uplink.Project, downloadConfigStorj DownloadConfigStorj, readFile *bytes.Reader) {
+// BackupPointer is the Storj location of a backup, as stored behind its shareable hash.
+// DataKey is nil for backups written before envelope encryption (Version 0).
+type BackupPointer struct {
+	Version    int
+	BaseCID    string
+	Name       string
+	ID         string
+	Bucket     string
+	UploadPath string
+	FileName   string
+	DataKey    []byte
+	Signature  *ManifestSignature
+}
+
+// ObjectName returns the name the objects of the backup are stored under, the base CID unless it is hidden.
+func (pointer BackupPointer) ObjectName() string {
+	if pointer.Name != "" {
+		return pointer.Name
+	}
+	return pointer.BaseCID
+}
 
-	makebuffer := make([]byte, 46)
+// Prefix returns the object key prefix all objects of the backup are stored under.
+func (pointer BackupPointer) Prefix() string {
+	return pointer.UploadPath + pointer.ObjectName() + "/"
+}
 
-	// Read data from IPFS
-	readHashData, err := readFile.Read(makebuffer)
-	if err != nil {
-		fmt.Println("Error reading file:", err)
+// ManifestKey returns the object key of the manifest of the backup.
+func (pointer BackupPointer) ManifestKey() string {
+	if pointer.Version == 0 {
+		return pointer.Prefix() + pointer.BaseCID + legacyMetaSuffix
 	}
+	return pointer.Prefix() + metadataName(pointer.ID, pointer.ObjectName()) + ManifestSuffix
+}
 
-	// Seperate the Hash and configration data
-	data := []byte(makebuffer[0:readHashData])
-	downloadFileName := string(data)
-	downloadFileSize := readFile.Size()
+// EnvelopeKey returns the object key of the copy of the envelope kept in the bucket.
+func (pointer BackupPointer) EnvelopeKey() string {
+	return pointer.Prefix() + metadataName(pointer.ID, pointer.ObjectName()) + EnvelopeSuffix
+}
+
+// metadataName returns the name of the manifest and envelope of a backup, without suffix.
+// Backups stored before they had IDs are named after their objects.
+func metadataName(id string, objectName string) string {
+	if id != "" {
+		return id
+	}
+	return objectName
+}
+
+// Suffixes of the objects describing a backup next to its chunks.
+const (
+	ManifestSuffix   = ".manifest"
+	EnvelopeSuffix   = ".envelope"
+	legacyMetaSuffix = ".txt"
+)
+
+// isMetadataObject reports whether key names the manifest, envelope or legacy meta file of a backup.
+func isMetadataObject(key string) bool {
+	return strings.HasSuffix(key, ManifestSuffix) || strings.HasSuffix(key, EnvelopeSuffix) || strings.HasSuffix(key, legacyMetaSuffix)
+}
 
-	restDataBuf := make([]byte, downloadFileSize-46)
-	readRestFile, err := readFile.Read(restDataBuf)
+// ReadPointer parses the pointer record read from IPFS and decrypts it with the given credentials.
+// Both envelopes and the legacy format of a base CID followed by the encrypted
+// Storj configuration are understood, the latter only with the key.
+func ReadPointer(readFile *bytes.Reader, credentials Credentials) BackupPointer {
+
+	data, err := ioutil.ReadAll(readFile)
 	if err != nil {
-		fmt.Println("Error reading file:", err)
+		log.Fatal("Error reading file: ", err)
 	}
 
-	dataEnc := []byte(restDataBuf[0:readRestFile])
-	pkey := []byte(downloadConfigStorj.Key)
+	if len(data) > 0 && data[0] == '{' {
+		envelope := ParseEnvelope(data)
+		pointer, err := envelope.Open(credentials)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return pointer
+	}
+
+	if credentials.Key == "" {
+		log.Fatal("Backups stored before envelopes can only be restored with the key")
+	}
+	return readLegacyPointer(data, credentials.Key)
+}
+
+// ParseEnvelope parses an envelope read from IPFS.
+func ParseEnvelope(data []byte) Envelope {
+	var envelope Envelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		log.Fatal("Invalid backup envelope: ", err)
+	}
+	return envelope
+}
+
+// readLegacyPointer separates the base CID from the encrypted Storj configuration
+// of a backup written before envelopes and decrypts the latter with the given key.
+func readLegacyPointer(data []byte, key string) BackupPointer {
+
+	if len(data) <= 46 {
+		log.Fatal("Invalid backup configuration data")
+	}
+
+	// Seperate the Hash and configration data
+	downloadFileName := string(data[:46])
+	dataEnc := data[46:]
+	pkey := []byte(key)
 
 	// Decrypt the configration data
 	decryptData, err := decrypt(pkey, dataEnc)
@@ -255,86 +674,464 @@ func DownloadData(project *uplink.Project, downloadConfigStorj DownloadConfigSto
 
 	// Split the configration data
 	splitStorjData := strings.Split(string(decryptData), ",")
-	downloadBucket := splitStorjData[0]
-	downloadPath := splitStorjData[1]
-	lastFileName := splitStorjData[2]
+	if len(splitStorjData) < 3 {
+		log.Fatal("Invalid backup configuration data")
+	}
+
+	return BackupPointer{
+		BaseCID:    downloadFileName,
+		Bucket:     splitStorjData[0],
+		UploadPath: splitStorjData[1],
+		FileName:   splitStorjData[2],
+	}
+}
+
+// writeLegacyPointer encrypts the Storj location of a legacy backup with key
+// and prepends the base CID, as the pointer was stored before envelopes.
+func writeLegacyPointer(pointer BackupPointer, key string) ([]byte, error) {
+
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("legacy backups need a key of 16, 24 or 32 characters, got %d", len(key))
+	}
+
+	ipfsStorjData := pointer.Bucket + "," + pointer.UploadPath + "," + pointer.FileName
+	storjEncryptData, err := encrypt([]byte(key), []byte(ipfsStorjData))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(pointer.BaseCID), storjEncryptData...), nil
+}
+
+// UploadManifest seals the manifest of a backup with its data key and uploads it.
+// It returns the digest of the manifest to be signed.
+func UploadManifest(project *uplink.Project, configStorj ConfigStorj, dataKey []byte, manifest Manifest) []byte {
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sealed, err := SealData(dataKey, data)
+	if err != nil {
+		log.Fatal("Could not encrypt manifest: ", err)
+	}
+
+	// Store the manifest on storj network with baseCID/backupID.manifest
+	UploadData(project, configStorj, manifest.ManifestObject(), bytes.NewReader(sealed))
+
+	digest := sha256.Sum256(data)
+	return digest[:]
+}
+
+// UploadEnvelope keeps a copy of the envelope of a backup in the bucket,
+// so that it can be found again without knowing its shareable hash.
+func UploadEnvelope(project *uplink.Project, configStorj ConfigStorj, envelope Envelope) {
+
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Store the envelope on storj network with baseCID/backupID.envelope
+	UploadData(project, configStorj, envelope.StoredObject(), bytes.NewReader(data))
+}
+
+// ReadStoredEnvelopes downloads the copies of the envelopes kept under the given backup prefix,
+// one for every backup of the same input. There are none for backups written in the legacy format.
+func ReadStoredEnvelopes(project *uplink.Project, bucket string, prefix string) []Envelope {
 
 	ctx := context.Background()
-	var dataDownload []byte
-	var lastIndex int64
-	var buf = make([]byte, 32768)
-	lastIndex = 0
+	var envelopes []Envelope
+	objects := project.ListObjects(ctx, bucket, &uplink.ListObjectsOptions{Prefix: prefix})
+	for objects.Next() {
+		key := objects.Item().Key
+		if objects.Item().IsPrefix || !strings.HasSuffix(key, EnvelopeSuffix) {
+			continue
+		}
+
+		download, err := project.DownloadObject(ctx, bucket, key, nil)
+		if err != nil {
+			log.Fatal("Could not open envelope: ", err)
+		}
+		data, err := ioutil.ReadAll(download)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = download.Close(); err != nil {
+			log.Fatal(err)
+		}
+		envelopes = append(envelopes, ParseEnvelope(data))
+	}
+	if err := objects.Err(); err != nil {
+		log.Fatal("Could not list envelopes: ", err)
+	}
+	return envelopes
+}
+
+// PrivatePointerPrefix is the prefix, under the upload path, of the envelopes of private backups,
+// stored under their shareable hash.
+const PrivatePointerPrefix = ".pointers/"
+
+// SaveEnvelope keeps a copy of the envelope in the bucket and returns the shareable hash of the backup.
+// Envelopes are published to IPFS unless they are private: their hash is then only computed by the node,
+// which provides nothing to the network, and the envelope is stored under it in the bucket.
+func SaveEnvelope(project *uplink.Project, ipfsShell *shell.Shell, configStorj ConfigStorj, envelope Envelope) string {
 
-	fmt.Printf("Downloading %s...\n", downloadFileName)
+	UploadEnvelope(project, configStorj, envelope)
+	if !envelope.Private {
+		return PublishEnvelope(ipfsShell, envelope)
+	}
 
-	// Loop to read the object in chunks and store the read data in a byte array.
-	download, err3 := project.DownloadObject(ctx, downloadBucket, downloadPath+downloadFileName+"/"+downloadFileName+".txt", &uplink.DownloadOptions{Offset: lastIndex, Length: int64(cap(buf))})
-	if err3 != nil {
-		fmt.Println("Error: ", err3)
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		log.Fatal(err)
 	}
+	hash := CreateCID(ipfsShell, data)
+	uploadObject(project, configStorj, PrivatePointerPrefix+hash, bytes.NewReader(data))
+	return hash
+}
+
+// PrivateEnvelopeKey returns the key of the object the envelope of a private backup is stored in.
+// Envelopes are looked up by hash before their backup is known, so they can not be stored under
+// the prefix of the backup; accesses shared for it are given this key as a prefix instead.
+// Storj matches the encrypted key, whose last element is encrypted as a whole,
+// so such an access reaches this envelope and none of the others.
+func PrivateEnvelopeKey(configStorj ConfigStorj, hash string) string {
+	return configStorj.UploadPath + PrivatePointerPrefix + hash
+}
 
-	var err2 error
-	dataDownload, err2 = ioutil.ReadAll(download)
-	if err2 != nil {
+// EnvelopeHash returns the shareable hash of an envelope without adding it to IPFS:
+// the hash it was published under, or the one a private envelope is stored under.
+func EnvelopeHash(ipfsShell *shell.Shell, envelope Envelope) string {
+	data, err := json.Marshal(envelope)
+	if err != nil {
 		log.Fatal(err)
 	}
+	return CreateCID(ipfsShell, data)
+}
+
+// DeletePrivateEnvelope removes the envelope a private backup was shared with under hash.
+func DeletePrivateEnvelope(project *uplink.Project, configStorj ConfigStorj, hash string) error {
+	_, err := project.DeleteObject(context.Background(), configStorj.Bucket, PrivateEnvelopeKey(configStorj, hash))
+	if errors.Is(err, uplink.ErrObjectNotFound) {
+		return nil
+	}
+	return err
+}
+
+// ReadPrivateEnvelope returns the envelope of the private backup behind hash, in the form ReadPointer takes,
+// or false when the bucket holds none and the hash has to be read from IPFS.
+func ReadPrivateEnvelope(project *uplink.Project, configStorj ConfigStorj, hash string) (*bytes.Reader, bool) {
+
+	// Accesses shared for other backups may not reach the envelopes of private ones.
+	download, err := project.DownloadObject(context.Background(), configStorj.Bucket, PrivateEnvelopeKey(configStorj, hash), nil)
+	if errors.Is(err, uplink.ErrObjectNotFound) || errors.Is(err, uplink.ErrPermissionDenied) {
+		return nil, false
+	}
+	if err != nil {
+		log.Fatal("Could not open envelope: ", err)
+	}
+
+	data, err := ioutil.ReadAll(download)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = download.Close(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintln(statusOut, "\nRead the envelope of private backup", hash, "from the bucket")
+	return bytes.NewReader(data), true
+}
+
+// ReadPointerRecord returns the record behind a shareable hash: the envelope of a private backup
+// from the bucket, or else whatever IPFS holds under the hash.
+func ReadPointerRecord(project *uplink.Project, configStorj ConfigStorj, ipfsShell *shell.Shell, hash string) *bytes.Reader {
+	if reader, ok := ReadPrivateEnvelope(project, configStorj, hash); ok {
+		return reader
+	}
+	return GetReaderDownload(ipfsShell, hash)
+}
+
+// ReadManifest downloads and decrypts the manifest of a backup.
+// For legacy backups the manifest is built from the plain list of chunk CIDs.
+func ReadManifest(project *uplink.Project, pointer BackupPointer) Manifest {
+
+	ctx := context.Background()
+
+	download, err := project.DownloadObject(ctx, pointer.Bucket, pointer.ManifestKey(), nil)
+	if err != nil {
+		log.Fatal("Could not open manifest: ", err)
+	}
+
+	dataDownload, err := ioutil.ReadAll(download)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = download.Close(); err != nil {
+		log.Fatal(err)
+	}
+
+	if pointer.Version > 0 {
+		data, err := OpenData(pointer.DataKey, dataDownload)
+		if err != nil {
+			log.Fatal("Could not decrypt manifest: ", err)
+		}
+		var manifest Manifest
+		if err = json.Unmarshal(data, &manifest); err != nil {
+			log.Fatal("Invalid manifest: ", err)
+		}
+		if manifest.BaseCID != pointer.BaseCID || manifest.ID != pointer.ID {
+			log.Fatal("Manifest does not belong to backup ", pointer.BaseCID)
+		}
+		digest := sha256.Sum256(data)
+		manifest.Digest = digest[:]
+		return manifest
+	}
 
 	//Convert byte array into String
 	receiveContentsMeta := string(dataDownload)
 
 	receiveContentsMeta = strings.TrimSuffix(receiveContentsMeta, ",")
 
-	downloadFileNamesDEBUG := strings.Split(receiveContentsMeta, ",")
+	manifest := Manifest{BaseCID: pointer.BaseCID, FileName: pointer.FileName}
+	for _, chunkCID := range strings.Split(receiveContentsMeta, ",") {
+		manifest.Chunks = append(manifest.Chunks, ManifestChunk{CID: chunkCID})
+	}
+	return manifest
+}
+
+// ChunksSize returns the total size of the stored chunk objects of a backup.
+// It returns 0, an unknown size, when the access does not allow listing, as shared accesses usually don't.
+func ChunksSize(project *uplink.Project, pointer BackupPointer) int64 {
+
+	var size int64
+	objects := project.ListObjects(context.Background(), pointer.Bucket, &uplink.ListObjectsOptions{
+		Prefix: pointer.Prefix(),
+		System: true,
+	})
+	for objects.Next() {
+		item := objects.Item()
+		if !item.IsPrefix && !isMetadataObject(item.Key) {
+			size += item.System.ContentLength
+		}
+	}
+	if err := objects.Err(); err != nil {
+		if errors.Is(err, uplink.ErrPermissionDenied) {
+			return 0
+		}
+		log.Fatal("Could not list backup objects: ", err)
+	}
+	return size
+}
 
-	var fileNameDownload = downloadConfigStorj.DownloadPath + "/" + lastFileName
+// StoredSize returns the total size of the stored chunks of a backup.
+// Manifests with chunk digests know it, including reused chunks; for older backups the objects are listed.
+func StoredSize(project *uplink.Project, pointer BackupPointer, manifest Manifest) int64 {
+	var size int64
+	for _, chunk := range manifest.Chunks {
+		if chunk.SHA256 == nil {
+			return ChunksSize(project, pointer)
+		}
+		size += chunk.Size + sealOverhead
+	}
+	return size
+}
 
-	_ = os.Remove(fileNameDownload)
+// RestoreChunks downloads and decrypts the chunks of a backup and writes them, in order, to writer.
+// Progress is counted in downloaded bytes and chunks. It returns the number of restored bytes.
+func RestoreChunks(project *uplink.Project, pointer BackupPointer, chunks []ManifestChunk, writer io.Writer, tracker *ProgressTracker) (int64, error) {
 
-	hmkey := []byte("This is a storj ipfs private key")
+	ctx := context.Background()
+	var restored int64
 
-	for _, filename := range downloadFileNamesDEBUG {
-		downloadObj, err := project.DownloadObject(ctx, downloadBucket, downloadPath+downloadFileName+"/"+filename, &uplink.DownloadOptions{Offset: lastIndex, Length: int64(cap(buf))})
+	for _, chunk := range chunks {
+		objectKey := chunk.ObjectKey(pointer)
+		downloadObj, err := project.DownloadObject(ctx, pointer.Bucket, objectKey, nil)
 		if err != nil {
-			log.Fatalf("Could not open object at %q: %v", downloadPath+downloadFileName+"/"+filename, err)
-		}
-		if _, err = os.Stat("./debug"); os.IsNotExist(err) {
-			err1 := os.Mkdir("./debug"+"/"+lastFileName, 0750)
-			if err1 != nil {
-				log.Fatal("Could not create debug folder: ", err1)
-			}
+			return restored, fmt.Errorf("could not open object at %q: %v", objectKey, err)
 		}
 
 		// Read everything from the stream.
-		receivedContents, err := ioutil.ReadAll(downloadObj)
+		receivedContents, err := ioutil.ReadAll(tracker.Reader(downloadObj))
 		if err != nil {
-			log.Fatal("Could not Read All content in stream:", err)
+			return restored, fmt.Errorf("could not read all content in stream: %v", err)
+		}
+		if err = downloadObj.Close(); err != nil {
+			return restored, err
+		}
+
+		// Chunks listed with a digest must be exactly the ones stored with the manifest.
+		if chunk.SHA256 != nil {
+			if digest := sha256.Sum256(receivedContents); !bytes.Equal(digest[:], chunk.SHA256) {
+				return restored, fmt.Errorf("chunk %s does not match its digest in the manifest", chunk.CID)
+			}
 		}
 
 		//Decryt the downloaded file data from storj
-		dec, err := decrypt(hmkey, receivedContents)
+		dec, err := pointer.decryptChunk(chunk, receivedContents)
 		if err != nil {
-			log.Fatal("Could not decrypt received data:", err)
+			return restored, fmt.Errorf("could not decrypt chunk %s: %v", chunk.CID, err)
 		}
-		// Create/open file in append mode.
-		downloadFileDisk, err := os.OpenFile(filepath.Join("./debug", lastFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0750)
-		if err != nil {
-			log.Fatal(err)
+
+		if _, err = writer.Write(dec); err != nil {
+			return restored, err
 		}
+		restored += int64(len(dec))
+		tracker.ChunkDone()
+	}
+	return restored, nil
+}
 
-		// read data
-		dataReader := bytes.NewReader(dec)
-		_, err = io.Copy(downloadFileDisk, dataReader)
-		if err != nil {
+// legacyChunkKey is the constant key chunks were encrypted with before envelopes.
+var legacyChunkKey = []byte("This is a storj ipfs private key")
+
+// decryptChunk decrypts a chunk with the data key of the backup,
+// or of the earlier backup it was reused from.
+func (pointer BackupPointer) decryptChunk(chunk ManifestChunk, data []byte) ([]byte, error) {
+	if pointer.Version == 0 {
+		return decrypt(legacyChunkKey, data)
+	}
+	if chunk.DataKey != nil {
+		return OpenData(chunk.DataKey, data)
+	}
+	return OpenData(pointer.DataKey, data)
+}
+
+// DownloadData function downloads the data from storj bucket after upload to verify data is uploaded successfully.
+// The progress callback may be nil.
+func DownloadData(project *uplink.Project, downloadConfigStorj DownloadConfigStorj, readFile *bytes.Reader, progress ProgressFunc) DownloadResult {
+	return RestoreBackup(project, downloadConfigStorj, ReadPointer(readFile, downloadConfigStorj.Credentials()), progress)
+}
+
+// RestoreBackup restores the backup a decrypted pointer refers to into the configured destination.
+// The progress callback may be nil.
+func RestoreBackup(project *uplink.Project, downloadConfigStorj DownloadConfigStorj, pointer BackupPointer, progress ProgressFunc) DownloadResult {
+
+	start := time.Now()
+
+	fmt.Fprintf(statusOut, "Downloading %s...\n", pointer.BaseCID)
+
+	manifest := ReadManifest(project, pointer)
+
+	result := DownloadResult{
+		BaseCID:  pointer.BaseCID,
+		Bucket:   pointer.Bucket,
+		Prefix:   pointer.Prefix(),
+		FileName: pointer.FileName,
+		Chunks:   len(manifest.Chunks),
+	}
+	result.Signature, result.Signer = CheckSignature(pointer, manifest, downloadConfigStorj.TrustPolicy())
+
+	// Backups of MFS are rebuilt file by file.
+	if manifest.MFS != nil {
+		result = RestoreTree(project, downloadConfigStorj, pointer, manifest, result, progress)
+		result.DurationSeconds = time.Since(start).Seconds()
+		return result
+	}
+
+	// Backups of DAGs are imported block by block when asked to, otherwise restored as CAR files.
+	if manifest.DAG != nil {
+		result.RootCID = manifest.DAG.Root
+	}
+	if manifest.DAG != nil && downloadConfigStorj.ImportDAG {
+		var err error
+		result.Destination = "/ipfs/" + manifest.DAG.Root
+		if result.Bytes, err = ImportBackupDAG(project, downloadConfigStorj.IPFS, pointer, manifest, progress); err != nil {
 			log.Fatal(err)
 		}
+		fmt.Fprintf(statusOut, "\n DAG %s imported and pinned\n", manifest.DAG.Root)
+		result.DurationSeconds = time.Since(start).Seconds()
+		return result
+	}
 
-		// Close the file handle after reading from it.
-		if err = downloadFileDisk.Close(); err != nil {
-			log.Fatal(err)
+	// Open the file, or stdout, the restored data is written to.
+	downloadFileDisk, fileNameDownload, err := OpenRestoreWriter(downloadConfigStorj.DownloadPath, pointer.FileName, downloadConfigStorj.Overwrite)
+	result.Destination = fileNameDownload
+	if err == errSkipDestination {
+		fmt.Fprintf(statusOut, "\n file \"%s\" already exists, skipping download\n", fileNameDownload)
+		result.Skipped = true
+		return result
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// A CARv2 file is the CARv1 export behind a header giving its size.
+	if manifest.DAG != nil && downloadConfigStorj.CARVersion == 2 {
+		header := CARv2Header(manifest.Size)
+		if _, err = downloadFileDisk.Write(header); err != nil {
+			downloadFileDisk.Abort()
+			log.Fatal("Could not write CARv2 header: ", err)
+		}
+	}
+
+	var tracker *ProgressTracker
+	if progress != nil {
+		tracker = NewProgressTracker("download", StoredSize(project, pointer, manifest), len(manifest.Chunks), progress)
+	}
+
+	// The restored content is added to IPFS while it is written, DAGs are imported instead.
+	var writer io.Writer = downloadFileDisk
+	var adder *IPFSAdder
+	if downloadConfigStorj.AddToIPFS && manifest.DAG == nil {
+		adder = NewIPFSAdder(downloadConfigStorj.IPFS, manifest.AddOptions())
+		writer = io.MultiWriter(downloadFileDisk, adder)
+	}
+
+	result.Bytes, err = RestoreChunks(project, pointer, manifest.Chunks, writer, tracker)
+	if adder != nil {
+		var addErr error
+		result.AddedCID, addErr = adder.Finish(err)
+		if err == nil && addErr != nil {
+			err = fmt.Errorf("could not add restored content to IPFS: %v", addErr)
+		}
+	}
+	if err != nil {
+		downloadFileDisk.Abort()
+		log.Fatal(err)
+	}
+	tracker.Finish()
+
+	// Move the completed file into place.
+	if err = downloadFileDisk.Commit(); err != nil {
+		log.Fatal("Could not save downloaded file: ", err)
+	}
+	fileNameDownload = downloadFileDisk.Destination()
+	result.Destination = fileNameDownload
+	fmt.Fprintf(statusOut, "File downloading: Complete!\n")
+	fmt.Fprintf(statusOut, "\n file \"%s\" downloaded to \"%s\"\n", pointer.FileName, fileNameDownload)
+	if adder != nil {
+		fmt.Fprintln(statusOut, "Added to IPFS as", result.AddedCID)
+		switch {
+		case result.AddedCID == pointer.BaseCID:
+		case manifest.Add == nil:
+			fmt.Fprintln(statusOut, "It differs from the base CID, the backup does not record the parameters it was added with")
+		default:
+			fmt.Fprintln(statusOut, "It differs from the base CID, the node does not add with the recorded parameters")
 		}
 	}
-	fmt.Printf("File downloading: Complete!\n")
-	fmt.Printf("\n file \"%s\" downloaded to \"%s\"\n", lastFileName, "debug/")
+
+	result.DurationSeconds = time.Since(start).Seconds()
+	return result
+}
+
+// Encrypt Function to encrypt data with specified key.
+// It is only used for pointers in the legacy format.
+func encrypt(key, text []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	b := base64.StdEncoding.EncodeToString(text)
+	ciphertext := make([]byte, aes.BlockSize+len(b))
+	iv := ciphertext[:aes.BlockSize]
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	cfb := cipher.NewCFBEncrypter(block, iv)
+	cfb.XORKeyStream(ciphertext[aes.BlockSize:], []byte(b))
+	return ciphertext, nil
 }
 
 // Function to decrypt data based on given key.
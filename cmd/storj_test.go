@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"storj.io/common/encryption"
+	"storj.io/common/macaroon"
+	"storj.io/common/paths"
+	"storj.io/common/storj"
+	"storj.io/uplink"
+	"storj.io/uplink/private/access2"
+)
+
+func TestParseShareTime(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{value: "", want: time.Time{}},
+		{value: "0", want: time.Time{}},
+		{value: " 0 ", want: time.Time{}},
+		{value: "2024-04-01T08:30:00Z", want: time.Date(2024, 4, 1, 8, 30, 0, 0, time.UTC)},
+		{value: "2024-04-01T08:30:00+02:00", want: time.Date(2024, 4, 1, 6, 30, 0, 0, time.UTC)},
+		{value: "2024-04-01_08:30:00", want: time.Date(2024, 4, 1, 8, 30, 0, 0, time.UTC)},
+		{value: "2024-04-01", want: time.Date(2024, 4, 1, 0, 0, 0, 0, time.Local)},
+		{value: " 2024-04-01 ", want: time.Date(2024, 4, 1, 0, 0, 0, 0, time.Local)},
+		{value: "+72h", want: now.Add(72 * time.Hour)},
+		{value: "90m", want: now.Add(90 * time.Minute)},
+		{value: "7d", want: now.AddDate(0, 0, 7)},
+		{value: "2w", want: now.AddDate(0, 0, 14)},
+		{value: "1d12h", want: now.Add(36 * time.Hour)},
+		{value: "1w2d3h", want: now.Add(9*24*time.Hour + 3*time.Hour)},
+		{value: "-3d", want: now.AddDate(0, 0, -3)},
+		{value: "-1h30m", want: now.Add(-90 * time.Minute)},
+	}
+	for _, test := range tests {
+		got, err := ParseShareTime(test.value, now)
+		if err != nil {
+			t.Errorf("%q: %v", test.value, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("%q: got %s, want %s", test.value, got, test.want)
+		}
+	}
+}
+
+func TestParseShareTimeRejects(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, value := range []string{
+		"tomorrow",
+		"+",
+		"-",
+		"d",
+		"1.5d",
+		"2d1w",
+		"-2w-1d",
+		"--3h",
+		"+-3h",
+		"7dx",
+		"3 days",
+		"2024-04-31",
+		"2024-4-1",
+		"2024-13-01T00:00:00Z",
+		"01/04/2024 08:30",
+	} {
+		if got, err := ParseShareTime(value, now); err == nil {
+			t.Errorf("%q: got %s, want an error", value, got)
+		}
+	}
+}
+
+func TestRemovedShareSettings(t *testing.T) {
+	tests := []struct {
+		config string
+		want   []string
+	}{
+		{config: `{"bucket": "b", "allowDownload": "true"}`},
+		{config: `{"allowUpload": "false", "allowList": "false", "allowDelete": "false"}`, want: []string{"allowUpload", "allowList", "allowDelete"}},
+		{config: `{"allowDelete": "true"}`, want: []string{"allowDelete"}},
+		{config: `not json`},
+	}
+	for _, test := range tests {
+		got := removedShareSettings([]byte(test.config))
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("%s: got %q, want %q", test.config, got, test.want)
+		}
+	}
+}
+
+func TestBackupPointerKeys(t *testing.T) {
+	tests := []struct {
+		name                             string
+		pointer                          BackupPointer
+		prefix, manifestKey, envelopeKey string
+	}{
+		{
+			name:        "named by id",
+			pointer:     BackupPointer{Version: 1, BaseCID: "QmBase", Name: "0123abcd", ID: "0123abcd", UploadPath: "ipfs/"},
+			prefix:      "ipfs/0123abcd/",
+			manifestKey: "ipfs/0123abcd/0123abcd.manifest",
+			envelopeKey: "ipfs/0123abcd/0123abcd.envelope",
+		},
+		{
+			name:        "named by base cid",
+			pointer:     BackupPointer{Version: 1, BaseCID: "QmBase", ID: "0123abcd", UploadPath: "ipfs/"},
+			prefix:      "ipfs/QmBase/",
+			manifestKey: "ipfs/QmBase/0123abcd.manifest",
+			envelopeKey: "ipfs/QmBase/0123abcd.envelope",
+		},
+		{
+			name:        "without id",
+			pointer:     BackupPointer{Version: 1, BaseCID: "QmBase", Name: "hmacname", UploadPath: "ipfs/"},
+			prefix:      "ipfs/hmacname/",
+			manifestKey: "ipfs/hmacname/hmacname.manifest",
+			envelopeKey: "ipfs/hmacname/hmacname.envelope",
+		},
+		{
+			name:        "legacy",
+			pointer:     BackupPointer{BaseCID: "QmBase", UploadPath: "ipfs/"},
+			prefix:      "ipfs/QmBase/",
+			manifestKey: "ipfs/QmBase/QmBase.txt",
+			envelopeKey: "ipfs/QmBase/QmBase.envelope",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.pointer.Prefix(); got != test.prefix {
+				t.Errorf("prefix %q, want %q", got, test.prefix)
+			}
+			if got := test.pointer.ManifestKey(); got != test.manifestKey {
+				t.Errorf("manifest key %q, want %q", got, test.manifestKey)
+			}
+			if got := test.pointer.EnvelopeKey(); got != test.envelopeKey {
+				t.Errorf("envelope key %q, want %q", got, test.envelopeKey)
+			}
+		})
+	}
+}
+
+func TestSharePrefixes(t *testing.T) {
+	pointer := BackupPointer{Version: 1, BaseCID: "QmBase", Name: "0123abcd", ID: "0123abcd", Bucket: "backups", UploadPath: "ipfs/"}
+	envelopeKey := PrivateEnvelopeKey(ConfigStorj{UploadPath: "ipfs/"}, "QmEnvelope")
+	if envelopeKey != "ipfs/.pointers/QmEnvelope" {
+		t.Fatalf("private envelope key %q", envelopeKey)
+	}
+
+	prefixes := SharePrefixes(pointer, []string{"ipfs/0123abcd/", "ipfs/earlier/", envelopeKey})
+	var got []string
+	for _, prefix := range prefixes {
+		if prefix.Bucket != "backups" {
+			t.Fatalf("shared bucket %q", prefix.Bucket)
+		}
+		got = append(got, prefix.Prefix)
+	}
+	if want := "ipfs/0123abcd/,ipfs/earlier/,ipfs/.pointers/QmEnvelope"; strings.Join(got, ",") != want {
+		t.Fatalf("shared %q, want %s", got, want)
+	}
+
+	// The access reaches the objects of the backup and its own envelope, but no other envelope.
+	secret := []byte("project secret")
+	apiKey, err := macaroon.NewAPIKey(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rootKey storj.Key
+	copy(rootKey[:], "root key")
+	encAccess := access2.NewEncryptionAccessWithDefaultKey(&rootKey)
+	encAccess.SetDefaultPathCipher(storj.EncAESGCM)
+	serialized, err := (&access2.Access{SatelliteAddress: "us-central-1.tardigrade.io:7777", APIKey: apiKey, EncAccess: encAccess}).Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err := uplink.ParseAccess(serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := access.Share(uplink.ReadOnlyPermission(), prefixes...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized, err = shared.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharedAccess, err := access2.ParseAccess(serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		key     string
+		allowed bool
+	}{
+		{key: "ipfs/0123abcd/QmChunk", allowed: true},
+		{key: "ipfs/0123abcd/0123abcd.manifest", allowed: true},
+		{key: "ipfs/earlier/QmChunk", allowed: true},
+		{key: "ipfs/.pointers/QmEnvelope", allowed: true},
+		{key: "ipfs/.pointers/QmEnvelope2"},
+		{key: "ipfs/.pointers/QmOther"},
+		{key: "ipfs/other/QmChunk"},
+	} {
+		encrypted, err := encryption.EncryptPathWithStoreCipher("backups", paths.NewUnencrypted(test.key), encAccess.Store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		action := macaroon.Action{Op: macaroon.ActionRead, Bucket: []byte("backups"), EncryptedPath: []byte(encrypted.Raw()), Time: time.Now()}
+		err = sharedAccess.APIKey.Check(context.Background(), secret, action, nil)
+		if test.allowed && err != nil {
+			t.Errorf("%s: %v", test.key, err)
+		}
+		if !test.allowed && err == nil {
+			t.Errorf("%s: allowed", test.key)
+		}
+
+		// Allowed keys can be encrypted with the shared access as well, so that they can be downloaded.
+		if test.allowed {
+			sharedEncrypted, err := encryption.EncryptPathWithStoreCipher("backups", paths.NewUnencrypted(test.key), sharedAccess.EncAccess.Store)
+			if err != nil || sharedEncrypted.Raw() != encrypted.Raw() {
+				t.Errorf("%s: shared access encrypts it as %q (%v), want %q", test.key, sharedEncrypted.Raw(), err, encrypted.Raw())
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Text prefixes of plain and passphrase-protected restore tickets.
+const (
+	TicketPrefix       = "DRIVER-IPFS-TICKET:"
+	SealedTicketPrefix = "DRIVER-IPFS-TICKET-SEALED:"
+)
+
+// TicketVersion is the version of the restore ticket format.
+const TicketVersion = 1
+
+// EnvTicketPassphrase supplies the passphrase of protected restore tickets.
+const EnvTicketPassphrase = "DRIVER_IPFS_TICKET_PASSPHRASE"
+
+// RestoreTicket bundles everything needed to restore one backup: its shareable hash,
+// a serialized access scoped to its prefix and the decrypted pointer including the data key.
+// Restoring from a ticket needs neither IPFS nor any configuration file.
+type RestoreTicket struct {
+	Version       int                `json:"version"`
+	Hash          string             `json:"hash"`
+	Access        string             `json:"access"`
+	BackupVersion int                `json:"backupVersion"`
+	BaseCID       string             `json:"baseCID"`
+	Name          string             `json:"name,omitempty"`
+	BackupID      string             `json:"backupID,omitempty"`
+	Bucket        string             `json:"bucket"`
+	UploadPath    string             `json:"uploadPath"`
+	FileName      string             `json:"fileName"`
+	DataKey       []byte             `json:"dataKey,omitempty"`
+	Signature     *ManifestSignature `json:"signature,omitempty"`
+}
+
+// NewRestoreTicket creates the ticket of the backup behind hash.
+func NewRestoreTicket(hash string, access string, pointer BackupPointer) RestoreTicket {
+	return RestoreTicket{
+		Version:       TicketVersion,
+		Hash:          hash,
+		Access:        access,
+		BackupVersion: pointer.Version,
+		BaseCID:       pointer.BaseCID,
+		Name:          pointer.Name,
+		BackupID:      pointer.ID,
+		Bucket:        pointer.Bucket,
+		UploadPath:    pointer.UploadPath,
+		FileName:      pointer.FileName,
+		DataKey:       pointer.DataKey,
+		Signature:     pointer.Signature,
+	}
+}
+
+// Pointer returns the pointer of the backup the ticket restores.
+func (ticket RestoreTicket) Pointer() BackupPointer {
+	return BackupPointer{
+		Version:    ticket.BackupVersion,
+		BaseCID:    ticket.BaseCID,
+		Name:       ticket.Name,
+		ID:         ticket.BackupID,
+		Bucket:     ticket.Bucket,
+		UploadPath: ticket.UploadPath,
+		FileName:   ticket.FileName,
+		DataKey:    ticket.DataKey,
+		Signature:  ticket.Signature,
+	}
+}
+
+// Encode returns the text form of the ticket.
+// With a passphrase the ticket is sealed under a key derived from it, like data keys under the key.
+func (ticket RestoreTicket) Encode(passphrase string) (string, error) {
+	data, err := json.Marshal(ticket)
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return TicketPrefix + base64.RawURLEncoding.EncodeToString(data), nil
+	}
+	wrapped, err := WrapKey(passphrase, data)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := json.Marshal(wrapped)
+	if err != nil {
+		return "", err
+	}
+	return SealedTicketPrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// IsSealedTicket reports whether a ticket is protected with a passphrase.
+func IsSealedTicket(text string) bool {
+	return strings.HasPrefix(strings.TrimSpace(text), SealedTicketPrefix)
+}
+
+// DecodeTicket parses the text form of a ticket, opening it with passphrase if it is sealed.
+func DecodeTicket(text string, passphrase string) (RestoreTicket, error) {
+	text = strings.TrimSpace(text)
+
+	var data []byte
+	var err error
+	switch {
+	case strings.HasPrefix(text, SealedTicketPrefix):
+		sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(text, SealedTicketPrefix))
+		if err != nil {
+			return RestoreTicket{}, fmt.Errorf("invalid restore ticket: %v", err)
+		}
+		var wrapped WrappedKey
+		if err = json.Unmarshal(sealed, &wrapped); err != nil {
+			return RestoreTicket{}, fmt.Errorf("invalid restore ticket: %v", err)
+		}
+		if data, err = UnwrapKey(passphrase, wrapped); err != nil {
+			return RestoreTicket{}, errors.New("could not open the restore ticket, wrong passphrase?")
+		}
+	case strings.HasPrefix(text, TicketPrefix):
+		if data, err = base64.RawURLEncoding.DecodeString(strings.TrimPrefix(text, TicketPrefix)); err != nil {
+			return RestoreTicket{}, fmt.Errorf("invalid restore ticket: %v", err)
+		}
+	default:
+		return RestoreTicket{}, errors.New("invalid restore ticket: expected " + TicketPrefix + " or " + SealedTicketPrefix)
+	}
+
+	var ticket RestoreTicket
+	if err = json.Unmarshal(data, &ticket); err != nil {
+		return RestoreTicket{}, fmt.Errorf("invalid restore ticket: %v", err)
+	}
+	if ticket.Version != TicketVersion {
+		return RestoreTicket{}, fmt.Errorf("unsupported restore ticket version %d", ticket.Version)
+	}
+	return ticket, nil
+}
+
+// TicketPassphrase returns the passphrase of a restore ticket from the environment,
+// or asks for it on the terminal, twice when a ticket is being created.
+func TicketPassphrase(confirm bool) string {
+	if passphrase := os.Getenv(EnvTicketPassphrase); passphrase != "" {
+		fmt.Fprintf(statusOut, "Read ticket passphrase from environment %s\n", EnvTicketPassphrase)
+		return passphrase
+	}
+	passphrase, err := PromptSecret("Ticket passphrase", confirm)
+	if err == errNoTerminal {
+		log.Fatalf("No terminal to ask for the ticket passphrase: set %s", EnvTicketPassphrase)
+	}
+	if err != nil {
+		log.Fatal("Could not read the ticket passphrase: ", err)
+	}
+	return passphrase
+}
+
+// CreateTicket encodes the ticket of a backup, protected with passphrase unless it is empty, and prints it.
+func CreateTicket(hash string, access string, pointer BackupPointer, passphrase string) string {
+	ticket, err := NewRestoreTicket(hash, access, pointer).Encode(passphrase)
+	if err != nil {
+		log.Fatal("Could not create restore ticket: ", err)
+	}
+	fmt.Fprintln(statusOut, "Restore ticket: ", ticket)
+	return ticket
+}
+
+// DownloadTicket restores the backup of a ticket given as text or in a file.
+// Sealed tickets are opened with the passphrase from the environment or the terminal.
+func DownloadTicket(ticketText string, ticketFile string, downloadConfigStorj DownloadConfigStorj, progress ProgressFunc) DownloadResult {
+
+	if ticketFile != "" {
+		data, err := readSecretFile(ticketFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ticketText = data
+	}
+
+	passphrase := ""
+	if IsSealedTicket(ticketText) {
+		passphrase = TicketPassphrase(false)
+	}
+	ticket, err := DecodeTicket(ticketText, passphrase)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintln(statusOut, "\nRestoring from ticket of hash: ", ticket.Hash)
+
+	project := OpenSharedProject(ticket.Access)
+	defer func() {
+		_ = project.Close()
+	}()
+
+	return RestoreBackup(project, downloadConfigStorj, ticket.Pointer(), progress)
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRestoreTicket(t *testing.T) {
+	pointer := BackupPointer{
+		Version:    1,
+		BaseCID:    "QmBase",
+		Name:       "0123abcd",
+		ID:         "0123abcd",
+		Bucket:     "backups",
+		UploadPath: "ipfs/",
+		FileName:   "data.img",
+		DataKey:    bytes.Repeat([]byte{7}, 32),
+		Signature:  &ManifestSignature{PublicKey: []byte("public key"), Signature: []byte("signature")},
+	}
+
+	tests := []struct {
+		name       string
+		passphrase string
+		prefix     string
+	}{
+		{name: "plain", prefix: TicketPrefix},
+		{name: "sealed", passphrase: "correct horse", prefix: SealedTicketPrefix},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			text, err := NewRestoreTicket("QmHash", "access", pointer).Encode(test.passphrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(text, test.prefix) {
+				t.Fatalf("ticket %q does not start with %s", text, test.prefix)
+			}
+			if IsSealedTicket(text) != (test.passphrase != "") {
+				t.Fatalf("sealed is %v", IsSealedTicket(text))
+			}
+			if test.passphrase != "" {
+				sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(text, test.prefix))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if bytes.Contains(sealed, []byte("QmBase")) || bytes.Contains(sealed, []byte("access")) {
+					t.Fatal("sealed ticket shows its contents")
+				}
+			}
+
+			// Tickets are pasted around, surrounding whitespace does not matter.
+			ticket, err := DecodeTicket(" "+text+"\n", test.passphrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ticket.Hash != "QmHash" || ticket.Access != "access" || ticket.Version != TicketVersion {
+				t.Fatalf("decoded %+v", ticket)
+			}
+			if !reflect.DeepEqual(ticket.Pointer(), pointer) {
+				t.Fatalf("pointer %+v, want %+v", ticket.Pointer(), pointer)
+			}
+
+			// Tickets cut off while copying them are rejected.
+			if _, err = DecodeTicket(text[:len(text)-10], test.passphrase); err == nil {
+				t.Fatal("decoded a truncated ticket")
+			}
+		})
+	}
+}
+
+func TestDecodeTicketRejects(t *testing.T) {
+	ticket := NewRestoreTicket("QmHash", "access", BackupPointer{Version: 1, BaseCID: "QmBase", DataKey: []byte("data key")})
+	sealed, err := ticket.Encode("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket.Version = TicketVersion + 1
+	future, err := ticket.Encode("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		text       string
+		passphrase string
+		want       string
+	}{
+		{name: "wrong passphrase", text: sealed, passphrase: "battery staple", want: "wrong passphrase"},
+		{name: "no passphrase", text: sealed, want: "wrong passphrase"},
+		{name: "sealed truncated", text: sealed[:len(SealedTicketPrefix)+20], passphrase: "correct horse", want: "invalid restore ticket"},
+		{name: "empty", text: "", want: "invalid restore ticket"},
+		{name: "unknown prefix", text: "DRIVER-IPFS-POINTER:e30", want: "invalid restore ticket"},
+		{name: "not base64", text: TicketPrefix + "not base64!", want: "invalid restore ticket"},
+		{name: "not json", text: TicketPrefix + base64.RawURLEncoding.EncodeToString([]byte("ticket")), want: "invalid restore ticket"},
+		{name: "unsupported version", text: future, want: "unsupported restore ticket version"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := DecodeTicket(test.text, test.passphrase)
+			if err == nil {
+				t.Fatal("decoded")
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("error %q, want %q", err, test.want)
+			}
+		})
+	}
+}
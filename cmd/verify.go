@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	shell "github.com/ipfs/go-ipfs-api"
+	"github.com/spf13/cobra"
+	"storj.io/uplink"
+)
+
+// verifyCmd represents the verify command.
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Command to verify a backup stored on storj V3 network.",
+	Long:  `Command to download the backup referenced by the Hash, decrypt it and check that its content still matches the base CID.`,
+	Run:   storjVerify,
+}
+
+func init() {
+
+	// Setup the verify command with its flags.
+	rootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().StringP("ipfs", "i", "././config/ipfs_property_v01.json", "full filepath contaning IPFS configuration.")
+	verifyCmd.Flags().BoolP("accesskey", "a", false, "Connect to storj using access key(default connection method is by using API Key).")
+	verifyCmd.Flags().StringP("storj", "u", "././config/storj_config_v01.json", "full filepath contaning storj V3 configuration.")
+	verifyCmd.Flags().StringP("storjDown", "d", "././config/storj_download_v01.json", "full filepath contaning the hash and key of the backup to verify.")
+	verifyCmd.Flags().Bool("strict", false, "refuse backups that are not signed by a trusted key.")
+	verifyCmd.Flags().StringSlice("key-share", nil, "share of the key created by key split, repeated until the threshold is reached.")
+	verifyCmd.Flags().String("key-shares-file", "", "file containing shares of the key, one per line.")
+}
+
+func storjVerify(cmd *cobra.Command, args []string) {
+
+	// Process arguments from the CLI.
+	ipfsConfigfilePath, _ := cmd.Flags().GetString("ipfs")
+	fullFileNameDownload, _ := cmd.Flags().GetString("storjDown")
+	useAccessKey, _ := cmd.Flags().GetBool("accesskey")
+	fullFileNameStorj, _ := cmd.Flags().GetString("storj")
+	strict, _ := cmd.Flags().GetBool("strict")
+	keyShares, _ := cmd.Flags().GetStringSlice("key-share")
+	keySharesFile, _ := cmd.Flags().GetString("key-shares-file")
+
+	// Read storj network configurations from and external file and create a storj configuration object.
+	storjConfig := LoadStorjConfiguration(fullFileNameStorj)
+
+	// Read IPFS instance's configurations from an external file and create an IPFS configuration object.
+	configIpfs := LoadIpfsProperty(ipfsConfigfilePath)
+
+	// Connect to storj network using the specified credentials.
+	_, project := ConnectToStorj(fullFileNameStorj, storjConfig, useAccessKey)
+	defer func() {
+		_ = project.Close()
+	}()
+
+	// Read the hash and key of the backup to verify.
+	downloadConfig := LoadStorjDownloadConfiguration(fullFileNameDownload)
+	if len(keyShares) > 0 || keySharesFile != "" {
+		downloadConfig.Key = KeyFromShares(keyShares, keySharesFile)
+	}
+	if downloadConfig.Credentials().Empty() {
+		downloadConfig.Key = PromptKey(false)
+	}
+	if strict {
+		downloadConfig.Strict = true
+	}
+
+	// Connect to ipfs network using specified credentials.
+	ipfsShell := ConnectToIpfs(configIpfs)
+
+	reader := ReadPointerRecord(project, storjConfig, ipfsShell, downloadConfig.Hash)
+
+	result := VerifyData(project, ipfsShell, downloadConfig, reader, progressPrinter(cmd))
+	PrintResult(result)
+	if !result.Verified {
+		if outputFormat == OutputJSON {
+			os.Exit(1)
+		}
+		log.Fatal("Verification failed: restored content does not match the base CID")
+	}
+}
+
+// VerifyData downloads and decrypts every chunk of a backup and checks whether
+// the restored content hashes to the base CID recorded in its pointer.
+// The progress callback may be nil.
+func VerifyData(project *uplink.Project, ipfsShell *shell.Shell, downloadConfigStorj DownloadConfigStorj, readFile *bytes.Reader, progress ProgressFunc) VerifyResult {
+
+	start := time.Now()
+	pointer := ReadPointer(readFile, downloadConfigStorj.Credentials())
+
+	fmt.Fprintf(statusOut, "Verifying %s...\n", pointer.BaseCID)
+
+	manifest := ReadManifest(project, pointer)
+	signature, signer := CheckSignature(pointer, manifest, downloadConfigStorj.TrustPolicy())
+
+	var tracker *ProgressTracker
+	if progress != nil {
+		tracker = NewProgressTracker("verify", StoredSize(project, pointer, manifest), len(manifest.Chunks), progress)
+	}
+
+	// Hash the restored content while it is being downloaded.
+	pipeReader, pipeWriter := io.Pipe()
+	cidResult := make(chan string, 1)
+	go func() {
+		restoredCID, err := ipfsShell.Add(pipeReader, append(manifest.AddOptions(), shell.OnlyHash(true))...)
+		if err != nil {
+			_ = pipeReader.CloseWithError(err)
+		}
+		_, _ = io.Copy(ioutil.Discard, pipeReader)
+		cidResult <- restoredCID
+	}()
+
+	restored, err := RestoreChunks(project, pointer, manifest.Chunks, pipeWriter, tracker)
+	_ = pipeWriter.CloseWithError(err)
+	restoredCID := <-cidResult
+	if err != nil {
+		log.Fatal(err)
+	}
+	tracker.Finish()
+
+	if manifest.Add != nil {
+		fmt.Fprintln(statusOut, "Add parameters\t: ", manifest.Add)
+	}
+	fmt.Fprintln(statusOut, "Expected CID\t: ", pointer.BaseCID)
+	fmt.Fprintln(statusOut, "Restored CID\t: ", restoredCID)
+
+	result := VerifyResult{
+		BaseCID:         pointer.BaseCID,
+		RestoredCID:     restoredCID,
+		Verified:        restoredCID == pointer.BaseCID,
+		FileName:        pointer.FileName,
+		Bytes:           restored,
+		Chunks:          len(manifest.Chunks),
+		Signature:       signature,
+		Signer:          signer,
+		DurationSeconds: time.Since(start).Seconds(),
+	}
+	if result.Verified {
+		fmt.Fprintf(statusOut, "Backup of \"%s\" verified: %d chunks intact.\n", pointer.FileName, len(manifest.Chunks))
+	}
+	return result
+}
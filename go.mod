@@ -5,6 +5,9 @@ go 1.13
 require (
 	github.com/ipfs/go-ipfs-api v0.0.3
 	github.com/ipfs/go-ipfs-chunker v0.0.5
+	github.com/ipfs/go-ipfs-files v0.0.6
 	github.com/spf13/cobra v1.0.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	storj.io/common v0.0.0-20201207172416-78f4e59925c3
 	storj.io/uplink v1.4.4
 )